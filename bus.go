@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+)
+
+// Invalidation a message of invalidated cache data, keys are storage keys with prefix
+type Invalidation struct {
+	Source string   `json:"source,omitempty"` // id of the publisher, a subscriber ignores its own messages
+	Keys   []string `json:"keys,omitempty"`   // invalidated keys
+	Prefix string   `json:"prefix,omitempty"` // all keys with the prefix are invalidated
+	All    bool     `json:"all,omitempty"`    // all keys are invalidated
+}
+
+// Bus delivers invalidations between cache instances, like in-process memory
+// caches of several app instances in front of shared data
+type Bus interface {
+	// Publish sends invalidation to all subscribers
+	Publish(inv *Invalidation) error
+	// Subscribe registers fn to receive invalidations, returns a func to unsubscribe.
+	// A bus may lose messages, like on reconnect, it sends an invalidation
+	// with All set to make subscribers drop all local data.
+	Subscribe(fn func(inv *Invalidation)) (unsubscribe func())
+}
+
+// LocalBus an in-process bus, for tests and caches of one process
+type LocalBus struct {
+	mu   sync.RWMutex
+	subs map[int]func(inv *Invalidation)
+	next int
+}
+
+// NewLocalBus create an in-process bus
+func NewLocalBus() *LocalBus {
+	return &LocalBus{subs: make(map[int]func(inv *Invalidation))}
+}
+
+// Publish sends invalidation to all subscribers synchronously
+func (b *LocalBus) Publish(inv *Invalidation) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, fn := range b.subs {
+		fn(inv)
+	}
+	return nil
+}
+
+// Subscribe registers fn to receive invalidations, returns a func to unsubscribe
+func (b *LocalBus) Subscribe(fn func(inv *Invalidation)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.next
+	b.next++
+	b.subs[id] = fn
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs, id)
+	}
+}
+
+// newSourceID returns a random id of invalidation publisher
+func newSourceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCacheBus(t *testing.T) {
+	Convey("cache bus", t, func() {
+		bus := NewLocalBus()
+		newMemory := func() Cacher {
+			return New(Options{
+				Name:    "testBus",
+				Adapter: "memory",
+				Prefix:  "app:",
+				Config: map[string]interface{}{
+					"bus": bus,
+				},
+			})
+		}
+		m1, m2 := newMemory(), newMemory()
+
+		Convey("set and delete evict other instances", func() {
+			m1.Set("key", "1", 10)
+			m2.Set("key", "2", 10)
+			So(m1.Exist("key"), ShouldBeFalse)
+			So(m2.Exist("key"), ShouldBeTrue)
+
+			m1.(*Memory).SetLocal("key", "1", 10)
+			So(m1.Exist("key"), ShouldBeTrue)
+			So(m2.Exist("key"), ShouldBeTrue)
+			m1.Delete("key")
+			So(m2.Exist("key"), ShouldBeFalse)
+		})
+
+		Convey("tags and counters evict other instances", func() {
+			m2.(*Memory).SetLocal("tagged", "1", 10)
+			m1.SetWithTags("tagged", "1", 10, "tag")
+			So(m2.Exist("tagged"), ShouldBeFalse)
+			m2.SetWithTags("tagged", "2", 10, "tag")
+			m1.(*Memory).SetLocal("other", "1", 10)
+			m2.InvalidateTags("tag")
+			So(m1.Exist("other"), ShouldBeTrue)
+
+			m2.(*Memory).SetLocal("counter", 1, 10)
+			m1.Incr("counter")
+			So(m2.Exist("counter"), ShouldBeFalse)
+		})
+
+		Convey("flush evicts other instances", func() {
+			m2.(*Memory).SetLocal("flush", "1", 10)
+			m1.Flush()
+			So(m2.Exist("flush"), ShouldBeFalse)
+
+			other := New(Options{
+				Name:    "testBus",
+				Adapter: "memory",
+				Prefix:  "other:",
+				Config: map[string]interface{}{
+					"bus": bus,
+				},
+			})
+			other.Set("other", "1", 10)
+			m2.(*Memory).SetLocal("all", "1", 10)
+			m1.Flush()
+			So(other.Exist("other"), ShouldBeTrue)
+			m1.FlushAll()
+			So(other.Exist("other"), ShouldBeFalse)
+			So(m2.Exist("all"), ShouldBeFalse)
+		})
+
+		Convey("closed instance is not evicted", func() {
+			m2.(*Memory).SetLocal("closed", "1", 10)
+			So(m2.(*Memory).Close(), ShouldBeNil)
+			m1.Delete("closed")
+			So(m2.Exist("closed"), ShouldBeTrue)
+		})
+
+		Convey("bus must be a Bus", func() {
+			_, err := NewCacher("memory", Options{
+				Config: map[string]interface{}{"bus": "redis"},
+			})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -2,8 +2,8 @@
 package cache
 
 import (
-	"bytes"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
@@ -14,10 +14,14 @@ import (
 type Cacher interface {
 	// Exist return true if value cached by given key
 	Exist(key string) bool
-	// Get returns value to out by given key
+	// Get returns value to out by given key, an error matching ErrCacheMiss if not exist
 	Get(key string, out interface{}) error
 	// Set cache value by given key, cache ttl second
 	Set(key string, v interface{}, ttl int64) error
+	// SetWithTags cache value by given key like Set, and associates it with given tags
+	SetWithTags(key string, v interface{}, ttl int64, tags ...string) error
+	// InvalidateTags delete all cached data associated with given tags
+	InvalidateTags(tags ...string) error
 	// Incr increases cached int-type value by given key as a counter
 	// if key not exist, before increase set value with zero
 	Incr(key string) (int64, error)
@@ -25,30 +29,89 @@ type Cacher interface {
 	// if key not exist, before increase set value with zero
 	// NOTE: memcached returns uint type cannot be less than zero
 	Decr(key string) (int64, error)
+	// IncrBy increases cached int-type value by given key with delta atomically,
+	// if key not exist, before increase set value with zero
+	IncrBy(key string, delta int64) (int64, error)
+	// IncrByFloat increases cached numeric value by given key with float delta atomically,
+	// if key not exist, before increase set value with zero
+	IncrByFloat(key string, delta float64) (float64, error)
+	// IncrWithTTL increases cached int-type value by given key with delta atomically,
+	// if key not exist, the counter is created with ttl second,
+	// the ttl of an existing counter is not changed
+	IncrWithTTL(key string, delta int64, ttl int64) (int64, error)
 	// Delete delete cached data by given key
 	Delete(key string) error
-	// Flush flush cacher
+	// Flush delete all cached data under the cache prefix
 	Flush() error
+	// FlushAll delete all data of the storage backend, not only the cache prefix
+	FlushAll() error
+	// Scan calls fn for each cached key matching given glob pattern,
+	// the iteration stops when fn returns an error
+	Scan(pattern string, fn func(key string) error) error
+	// Keys returns cached keys which start with given prefix
+	Keys(prefix string) ([]string, error)
+	// Namespace returns a cacher sharing the storage with current cacher,
+	// whose keys are under the namespace of given name
+	Namespace(name string) Cacher
 	// Start new a cacher and start service
 	Start(Options) error
 }
 
+// ErrNotSupported returned by adapters cannot support an operation
+var ErrNotSupported = errors.New("cache: operation not supported by adapter")
+
+// ErrCacheMiss returned by Get if the key does not exist, match it by errors.Is,
+// adapters wrap the error of their clients, like redis.Nil and memcache.ErrCacheMiss
+var ErrCacheMiss = errors.New("cache: cache miss")
+
+// MissError wraps the cache miss error of an adapter client as ErrCacheMiss,
+// errors.Is matches both of them
+func MissError(err error) error {
+	return &missError{err}
+}
+
+// missError a cache miss error of an adapter client
+type missError struct {
+	err error
+}
+
+func (e *missError) Error() string {
+	return e.err.Error()
+}
+
+func (e *missError) Unwrap() error {
+	return e.err
+}
+
+func (e *missError) Is(target error) bool {
+	return target == ErrCacheMiss
+}
+
 // Item cache storage item
 type Item struct {
-	Val        interface{} // real object value
-	TTL        int64       // cache life time
-	Expiration int64       // expired time
+	Val            interface{}      // real object value
+	TTL            int64            // cache life time
+	Expiration     int64            // expired time
+	SoftExpiration int64            // stale time before expired time, 0 for never stale
+	Delta          int64            // nanoseconds spent computing the value, for early refresh
+	Tags           map[string]int64 // tag versions when cached, for adapters use tag versions
+	raw            bool             // Val is untyped text from storage, parsed by the type of out
 }
 
-// ItemBinary cache item encoded data
+// ItemBinary cache item encoded data in the wire format shared by all adapters
 type ItemBinary []byte
 
 // Options cache options
 type Options struct {
-	Name    string                 // cache name
-	Adapter string                 // adapter
-	Prefix  string                 // cache key prefix
-	Config  map[string]interface{} // config for adapter
+	Name    string                 `json:"name" yaml:"name"`       // cache name
+	Adapter string                 `json:"adapter" yaml:"adapter"` // adapter
+	Prefix  string                 `json:"prefix" yaml:"prefix"`   // cache key prefix
+	Config  map[string]interface{} `json:"config" yaml:"config"`   // config for adapter
+	// Jitter is the percent of ttl taken off at random by Set, so keys set together
+	// with one ttl expire at different seconds, 0 for no jitter
+	Jitter int `json:"jitter" yaml:"jitter"`
+	// JitterSeed is the random seed of jitter for repeatable ttl in tests, 0 for a random seed
+	JitterSeed int64 `json:"jitterSeed" yaml:"jitterSeed"`
 }
 
 type instanceFunc func() Cacher
@@ -92,6 +155,11 @@ func Register(name string, f instanceFunc) {
 	adapters[name] = f
 }
 
+// NamespacePrefix returns the key prefix of the namespace name under given prefix
+func NamespacePrefix(prefix, name string) string {
+	return prefix + name + ":"
+}
+
 // NewItem create a cache item
 func NewItem(val interface{}, ttl int64) *Item {
 	item := &Item{Val: val, TTL: ttl}
@@ -106,37 +174,68 @@ func (t *Item) Expired() bool {
 	return t.TTL > 0 && time.Now().UnixNano() >= t.Expiration
 }
 
+// Stale check item has passed its soft expiration
+func (t *Item) Stale() bool {
+	return t.SoftExpiration > 0 && time.Now().UnixNano() >= t.SoftExpiration
+}
+
 // Incr increases given value
 func (t *Item) Incr() error {
+	return t.IncrBy(1)
+}
+
+// Decr decreases given value
+func (t *Item) Decr() error {
+	return t.IncrBy(-1)
+}
+
+// IncrBy increases given value with delta, the value becomes int64
+func (t *Item) IncrBy(delta int64) error {
+	if t.raw {
+		n, err := strconv.ParseInt(t.Val.(string), 10, 64)
+		if err != nil {
+			return fmt.Errorf("item value is not int-type")
+		}
+		t.Val, t.raw = n, false
+	}
 	switch t.Val.(type) {
 	case int, int8, int16, int32, int64:
-		t.Val = reflect.ValueOf(t.Val).Int() + 1
+		t.Val = reflect.ValueOf(t.Val).Int() + delta
 	case uint, uint8, uint16, uint32, uint64:
-		t.Val = int64(reflect.ValueOf(t.Val).Uint()) + 1
+		t.Val = int64(reflect.ValueOf(t.Val).Uint()) + delta
 	default:
 		return fmt.Errorf("item value is not int-type")
 	}
 	return nil
 }
 
-// Decr decreases given value
-func (t *Item) Decr() error {
+// IncrByFloat increases given numeric value with float delta, the value becomes float64
+func (t *Item) IncrByFloat(delta float64) error {
+	if t.raw {
+		f, err := strconv.ParseFloat(t.Val.(string), 64)
+		if err != nil {
+			return fmt.Errorf("item value is not numeric")
+		}
+		t.Val, t.raw = f, false
+	}
 	switch t.Val.(type) {
 	case int, int8, int16, int32, int64:
-		t.Val = reflect.ValueOf(t.Val).Int() - 1
+		t.Val = float64(reflect.ValueOf(t.Val).Int()) + delta
 	case uint, uint8, uint16, uint32, uint64:
-		t.Val = int64(reflect.ValueOf(t.Val).Uint()) - 1
+		t.Val = float64(reflect.ValueOf(t.Val).Uint()) + delta
+	case float32, float64:
+		t.Val = reflect.ValueOf(t.Val).Float() + delta
 	default:
-		return fmt.Errorf("item value is not int-type")
+		return fmt.Errorf("item value is not numeric")
 	}
 	return nil
 }
 
-// Encode encode item to bytes by gob
+// Encode encode item to bytes, a number is encoded as untyped plain text parsed
+// by the type of out when decoded, so storages can change it as a counter.
+// Other simple values are encoded as text with their types, others by gob.
 func (t *Item) Encode() (ItemBinary, error) {
-	buf := bytes.NewBuffer(nil)
-	err := gob.NewEncoder(buf).Encode(t)
-	return buf.Bytes(), err
+	return encodeItem(t)
 }
 
 // Decode item value to out interface
@@ -158,23 +257,28 @@ func (t *Item) Decode(out interface{}) error {
 	if !rv.CanSet() {
 		return fmt.Errorf("cache: out cannot set value")
 	}
+	if t.raw {
+		return parseText(t.Val.(string), rv)
+	}
 	rt := reflect.ValueOf(t.Val)
 	if rt.Kind() == reflect.Ptr {
 		rt = rt.Elem()
 	}
 	if rv.Type() != rt.Type() {
+		// numbers convert like untyped text, string and []byte convert to each other
+		if ok, err := convertSimple(t.Val, rv); ok {
+			return err
+		}
 		return fmt.Errorf("cache: out is different type with stored value %v, %v", rv.Type(), rt.Type())
 	}
 	rv.Set(rt)
 	return nil
 }
 
-// Item decode bytes data to cache item use gob
+// Item decode bytes data to cache item,
+// untyped text is decoded to an item whose value is parsed by Decode
 func (t ItemBinary) Item() (*Item, error) {
-	buf := bytes.NewBuffer(t)
-	item := new(Item)
-	err := gob.NewDecoder(buf).Decode(&item)
-	return item, err
+	return decodeItem(t)
 }
 
 // SimpleType check value type is simple type or not
@@ -190,12 +294,16 @@ func SimpleType(v interface{}) bool {
 		return true
 	case bool:
 		return true
+	case []byte, time.Time, time.Duration:
+		return true
 	default:
 		return false
 	}
 }
 
 // SimpleValue return value to output with type convert
+//
+// Deprecated: parse errors are ignored, use ItemBinary.Item and Item.Decode instead.
 func SimpleValue(v []byte, o interface{}) bool {
 	switch o.(type) {
 	case *string:
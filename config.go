@@ -0,0 +1,339 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// NewFromURL create a Cacher by given url,
+// like redis://:pass@127.0.0.1:6379/2?poolsize=20&prefix=app
+func NewFromURL(rawurl string) (Cacher, error) {
+	o, err := ParseURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return NewCacher(o.Adapter, o)
+}
+
+// ParseURL parses given url to cache options, the scheme is the adapter,
+// query parameters name, prefix, jitter and jitterSeed are the cache options,
+// user, password, host, port, path and other query parameters are adapter config.
+func ParseURL(rawurl string) (Options, error) {
+	var o Options
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return o, fmt.Errorf("cache: invalid url: %v", err)
+	}
+	if u.Scheme == "" {
+		return o, fmt.Errorf("cache: url %q has no adapter scheme", rawurl)
+	}
+	o.Adapter = u.Scheme
+	o.Config = make(map[string]interface{})
+	if u.User != nil {
+		if name := u.User.Username(); name != "" {
+			o.Config["username"] = name
+		}
+		if pass, ok := u.User.Password(); ok {
+			o.Config["password"] = pass
+		}
+	}
+	if host := u.Hostname(); host != "" {
+		o.Config["host"] = host
+	}
+	if port := u.Port(); port != "" {
+		o.Config["port"] = port
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		o.Config["db"] = db
+	}
+	for key, values := range u.Query() {
+		switch key {
+		case "name":
+			o.Name = values[0]
+		case "prefix":
+			o.Prefix = values[0]
+		case "jitter":
+			if o.Jitter, err = strconv.Atoi(values[0]); err != nil {
+				return o, fmt.Errorf("cache: invalid jitter %q", values[0])
+			}
+		case "jitterSeed":
+			if o.JitterSeed, err = strconv.ParseInt(values[0], 10, 64); err != nil {
+				return o, fmt.Errorf("cache: invalid jitterSeed %q", values[0])
+			}
+		default:
+			if len(values) == 1 {
+				o.Config[key] = values[0]
+			} else {
+				o.Config[key] = values
+			}
+		}
+	}
+	if o.Name == "" {
+		o.Name = "_DEFAULT_"
+	}
+	return o, nil
+}
+
+// LoadOptions loads cache options from given json or yaml file
+func LoadOptions(path string) (Options, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Options{}, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return OptionsFromJSON(data)
+	case ".yml", ".yaml":
+		return OptionsFromYAML(data)
+	default:
+		return Options{}, fmt.Errorf("cache: unknown options file type %q", path)
+	}
+}
+
+// OptionsFromJSON parses cache options from json data
+func OptionsFromJSON(data []byte) (Options, error) {
+	var o Options
+	if err := json.Unmarshal(data, &o); err != nil {
+		return o, fmt.Errorf("cache: invalid json options: %v", err)
+	}
+	return o, nil
+}
+
+// OptionsFromYAML parses cache options from yaml data
+func OptionsFromYAML(data []byte) (Options, error) {
+	var o Options
+	if err := yaml.Unmarshal(data, &o); err != nil {
+		return o, fmt.Errorf("cache: invalid yaml options: %v", err)
+	}
+	return o, nil
+}
+
+// OptionsFromEnv loads cache options from environment variables with given prefix:
+// PREFIX_URL is parsed by ParseURL first, then PREFIX_NAME, PREFIX_ADAPTER, PREFIX_PREFIX,
+// PREFIX_JITTER, PREFIX_JITTER_SEED override the options, and PREFIX_CONFIG_KEY sets the config key,
+// words of a camel case key are separated by underscores, like PREFIX_CONFIG_MAX_IDLE_CONNS.
+func OptionsFromEnv(prefix string) (Options, error) {
+	var o Options
+	var err error
+	prefix = strings.ToUpper(prefix) + "_"
+	if v := os.Getenv(prefix + "URL"); v != "" {
+		if o, err = ParseURL(v); err != nil {
+			return o, err
+		}
+	}
+	if v := os.Getenv(prefix + "NAME"); v != "" {
+		o.Name = v
+	}
+	if v := os.Getenv(prefix + "ADAPTER"); v != "" {
+		o.Adapter = v
+	}
+	if v, ok := os.LookupEnv(prefix + "PREFIX"); ok {
+		o.Prefix = v
+	}
+	if v := os.Getenv(prefix + "JITTER"); v != "" {
+		if o.Jitter, err = strconv.Atoi(v); err != nil {
+			return o, fmt.Errorf("cache: invalid environment %sJITTER %q", prefix, v)
+		}
+	}
+	if v := os.Getenv(prefix + "JITTER_SEED"); v != "" {
+		if o.JitterSeed, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return o, fmt.Errorf("cache: invalid environment %sJITTER_SEED %q", prefix, v)
+		}
+	}
+	for _, env := range os.Environ() {
+		i := strings.IndexByte(env, '=')
+		if i < 0 || !strings.HasPrefix(env[:i], prefix+"CONFIG_") {
+			continue
+		}
+		if o.Config == nil {
+			o.Config = make(map[string]interface{})
+		}
+		o.Config[strings.ToLower(env[len(prefix+"CONFIG_"):i])] = env[i+1:]
+	}
+	if o.Adapter == "" {
+		return o, fmt.Errorf("cache: environment %sADAPTER or %sURL is not set", prefix, prefix)
+	}
+	return o, nil
+}
+
+// ConfigValue returns config value by key, falls back to case insensitive
+// match without underscores for config loaded from environment,
+// so max_idle_conns matches maxIdleConns
+func ConfigValue(config map[string]interface{}, key string) (interface{}, bool) {
+	if v, ok := config[key]; ok {
+		return v, true
+	}
+	key = strings.ReplaceAll(key, "_", "")
+	for k, v := range config {
+		if strings.EqualFold(strings.ReplaceAll(k, "_", ""), key) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// configError returns error of an invalid config value
+func configError(key, expect string, v interface{}) error {
+	return fmt.Errorf("cache: config %q expects %s, got %T(%v)", key, expect, v, v)
+}
+
+// ConfigString returns string config value by key, or def if key not set
+func ConfigString(config map[string]interface{}, key string, def string) (string, error) {
+	v, ok := ConfigValue(config, key)
+	if !ok {
+		return def, nil
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	default:
+		return def, configError(key, "string", v)
+	}
+}
+
+// ConfigInt returns int config value by key, or def if key not set
+func ConfigInt(config map[string]interface{}, key string, def int) (int, error) {
+	v, err := ConfigInt64(config, key, int64(def))
+	if err != nil {
+		return def, err
+	}
+	if int64(int(v)) != v {
+		return def, configError(key, "int", v)
+	}
+	return int(v), nil
+}
+
+// ConfigInt64 returns int64 config value by key, or def if key not set,
+// numeric strings and integral floats are accepted
+func ConfigInt64(config map[string]interface{}, key string, def int64) (int64, error) {
+	v, ok := ConfigValue(config, key)
+	if !ok {
+		return def, nil
+	}
+	switch t := v.(type) {
+	case int:
+		return int64(t), nil
+	case int8:
+		return int64(t), nil
+	case int16:
+		return int64(t), nil
+	case int32:
+		return int64(t), nil
+	case int64:
+		return t, nil
+	case uint:
+		return int64(t), nil
+	case uint8:
+		return int64(t), nil
+	case uint16:
+		return int64(t), nil
+	case uint32:
+		return int64(t), nil
+	case uint64:
+		if t <= math.MaxInt64 {
+			return int64(t), nil
+		}
+	case float32:
+		if float32(int64(t)) == t {
+			return int64(t), nil
+		}
+	case float64:
+		if float64(int64(t)) == t {
+			return int64(t), nil
+		}
+	case string:
+		if n, err := strconv.ParseInt(strings.TrimSpace(t), 10, 64); err == nil {
+			return n, nil
+		}
+	}
+	return def, configError(key, "integer", v)
+}
+
+// ConfigBool returns bool config value by key, or def if key not set
+func ConfigBool(config map[string]interface{}, key string, def bool) (bool, error) {
+	v, ok := ConfigValue(config, key)
+	if !ok {
+		return def, nil
+	}
+	switch t := v.(type) {
+	case bool:
+		return t, nil
+	case string:
+		if b, err := strconv.ParseBool(strings.TrimSpace(t)); err == nil {
+			return b, nil
+		}
+	}
+	return def, configError(key, "bool", v)
+}
+
+// ConfigDuration returns duration config value by key, or def if key not set,
+// a duration string like "1.5s" or a number of seconds is accepted
+func ConfigDuration(config map[string]interface{}, key string, def time.Duration) (time.Duration, error) {
+	v, ok := ConfigValue(config, key)
+	if !ok {
+		return def, nil
+	}
+	switch t := v.(type) {
+	case time.Duration:
+		return t, nil
+	case float32:
+		return time.Duration(float64(t) * float64(time.Second)), nil
+	case float64:
+		return time.Duration(t * float64(time.Second)), nil
+	case string:
+		if d, err := time.ParseDuration(strings.TrimSpace(t)); err == nil {
+			return d, nil
+		}
+		if n, err := strconv.ParseFloat(strings.TrimSpace(t), 64); err == nil {
+			return time.Duration(n * float64(time.Second)), nil
+		}
+	default:
+		if n, err := ConfigInt64(config, key, 0); err == nil {
+			return time.Duration(n) * time.Second, nil
+		}
+	}
+	return def, configError(key, "duration", v)
+}
+
+// ConfigStrings returns string list config value by key, or def if key not set,
+// a comma separated string is accepted
+func ConfigStrings(config map[string]interface{}, key string, def []string) ([]string, error) {
+	v, ok := ConfigValue(config, key)
+	if !ok {
+		return def, nil
+	}
+	switch t := v.(type) {
+	case []string:
+		return t, nil
+	case []interface{}:
+		list := make([]string, len(t))
+		for i := range t {
+			s, ok := t[i].(string)
+			if !ok {
+				return def, configError(key, "string list", v)
+			}
+			list[i] = s
+		}
+		return list, nil
+	case string:
+		var list []string
+		for _, s := range strings.Split(t, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+		return list, nil
+	}
+	return def, configError(key, "string list", v)
+}
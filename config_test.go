@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCacheParseURL(t *testing.T) {
+	Convey("parse url", t, func() {
+		o, err := ParseURL("redis://:pass@127.0.0.1:6379/2?poolsize=20&prefix=app")
+		So(err, ShouldBeNil)
+		So(o.Adapter, ShouldEqual, "redis")
+		So(o.Name, ShouldEqual, "_DEFAULT_")
+		So(o.Prefix, ShouldEqual, "app")
+		So(o.Config["host"], ShouldEqual, "127.0.0.1")
+		So(o.Config["port"], ShouldEqual, "6379")
+		So(o.Config["password"], ShouldEqual, "pass")
+		So(o.Config["db"], ShouldEqual, "2")
+		So(o.Config["poolsize"], ShouldEqual, "20")
+
+		o, err = ParseURL("memory://?jitter=10&jitterSeed=1")
+		So(err, ShouldBeNil)
+		So(o.Jitter, ShouldEqual, 10)
+		So(o.JitterSeed, ShouldEqual, 1)
+		So(o.Config, ShouldBeEmpty)
+		_, err = ParseURL("memory://?jitter=ten")
+		So(err, ShouldNotBeNil)
+
+		_, err = ParseURL("127.0.0.1:6379")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("new from url", t, func() {
+		c, err := NewFromURL("memory://?name=test&bytesLimit=2097152")
+		So(err, ShouldBeNil)
+		So(c.(*Memory).Name, ShouldEqual, "test")
+		So(c.(*Memory).bytesLimit, ShouldEqual, 2097152)
+
+		_, err = NewFromURL("memory://?bytesLimit=2m")
+		So(err, ShouldNotBeNil)
+		t.Logf("new from url: %v", err)
+
+		_, err = NewFromURL("unknown://")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestCacheLoadOptions(t *testing.T) {
+	dir, err := os.MkdirTemp("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	Convey("load options", t, func() {
+		Convey("json", func() {
+			path := filepath.Join(dir, "cache.json")
+			os.WriteFile(path, []byte(`{"name": "test", "adapter": "redis", "prefix": "app",
+				"config": {"host": "127.0.0.1", "port": 6379}}`), 0644)
+			o, err := LoadOptions(path)
+			So(err, ShouldBeNil)
+			So(o.Name, ShouldEqual, "test")
+			So(o.Adapter, ShouldEqual, "redis")
+			So(o.Prefix, ShouldEqual, "app")
+			port, err := ConfigInt(o.Config, "port", 0)
+			So(err, ShouldBeNil)
+			So(port, ShouldEqual, 6379)
+		})
+
+		Convey("yaml", func() {
+			path := filepath.Join(dir, "cache.yml")
+			os.WriteFile(path, []byte("name: test\nadapter: memory\nconfig:\n  bytesLimit: 2097152\n"), 0644)
+			o, err := LoadOptions(path)
+			So(err, ShouldBeNil)
+			So(o.Adapter, ShouldEqual, "memory")
+			limit, err := ConfigInt64(o.Config, "bytesLimit", 0)
+			So(err, ShouldBeNil)
+			So(limit, ShouldEqual, 2097152)
+		})
+
+		Convey("unknown type", func() {
+			_, err := LoadOptions(filepath.Join(dir, "cache.ini"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("options from env", t, func() {
+		os.Setenv("TESTCACHE_URL", "memory://?prefix=app")
+		os.Setenv("TESTCACHE_NAME", "test")
+		os.Setenv("TESTCACHE_CONFIG_BYTESLIMIT", "2097152")
+		os.Setenv("TESTCACHE_JITTER", "10")
+		os.Setenv("TESTCACHE_CONFIG_MAX_IDLE_CONNS", "8")
+		defer func() {
+			os.Unsetenv("TESTCACHE_URL")
+			os.Unsetenv("TESTCACHE_NAME")
+			os.Unsetenv("TESTCACHE_CONFIG_BYTESLIMIT")
+			os.Unsetenv("TESTCACHE_JITTER")
+			os.Unsetenv("TESTCACHE_CONFIG_MAX_IDLE_CONNS")
+		}()
+		o, err := OptionsFromEnv("testcache")
+		So(err, ShouldBeNil)
+		So(o.Adapter, ShouldEqual, "memory")
+		So(o.Name, ShouldEqual, "test")
+		So(o.Prefix, ShouldEqual, "app")
+		So(o.Jitter, ShouldEqual, 10)
+		limit, err := ConfigInt64(o.Config, "bytesLimit", 0)
+		So(err, ShouldBeNil)
+		So(limit, ShouldEqual, 2097152)
+		conns, err := ConfigInt(o.Config, "maxIdleConns", 0)
+		So(err, ShouldBeNil)
+		So(conns, ShouldEqual, 8)
+
+		_, err = OptionsFromEnv("testcachenotset")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestCacheConfig(t *testing.T) {
+	Convey("typed config", t, func() {
+		config := map[string]interface{}{
+			"host":    "127.0.0.1",
+			"port":    6379,
+			"db":      float64(2),
+			"size":    "20",
+			"bad":     true,
+			"enable":  "true",
+			"timeout": "1500ms",
+			"idle":    30,
+		}
+
+		s, err := ConfigString(config, "host", "")
+		So(err, ShouldBeNil)
+		So(s, ShouldEqual, "127.0.0.1")
+		s, err = ConfigString(config, "notExist", "def")
+		So(err, ShouldBeNil)
+		So(s, ShouldEqual, "def")
+		_, err = ConfigString(config, "port", "")
+		So(err, ShouldNotBeNil)
+
+		n, err := ConfigInt(config, "port", 0)
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 6379)
+		n, err = ConfigInt(config, "db", 0)
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 2)
+		n, err = ConfigInt(config, "SIZE", 0)
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 20)
+		_, err = ConfigInt(config, "bad", 0)
+		So(err, ShouldNotBeNil)
+		t.Logf("config int: %v", err)
+
+		b, err := ConfigBool(config, "enable", false)
+		So(err, ShouldBeNil)
+		So(b, ShouldBeTrue)
+		_, err = ConfigBool(config, "host", false)
+		So(err, ShouldNotBeNil)
+
+		d, err := ConfigDuration(config, "timeout", 0)
+		So(err, ShouldBeNil)
+		So(d, ShouldEqual, 1500*time.Millisecond)
+		d, err = ConfigDuration(config, "idle", 0)
+		So(err, ShouldBeNil)
+		So(d, ShouldEqual, 30*time.Second)
+		_, err = ConfigDuration(config, "host", 0)
+		So(err, ShouldNotBeNil)
+
+		config["addrs"] = "127.0.0.1:7000, 127.0.0.1:7001"
+		list, err := ConfigStrings(config, "addrs", nil)
+		So(err, ShouldBeNil)
+		So(list, ShouldResemble, []string{"127.0.0.1:7000", "127.0.0.1:7001"})
+		config["addrs"] = []interface{}{"127.0.0.1:7000"}
+		list, err = ConfigStrings(config, "addrs", nil)
+		So(err, ShouldBeNil)
+		So(list, ShouldResemble, []string{"127.0.0.1:7000"})
+		config["addrs"] = []interface{}{7000}
+		_, err = ConfigStrings(config, "addrs", nil)
+		So(err, ShouldNotBeNil)
+	})
+}
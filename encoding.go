@@ -0,0 +1,222 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// The wire format shared by all adapters.
+//
+// A number, time.Duration included as nanoseconds, is stored as untyped plain
+// text, so it can be read and changed by the storage itself, like INCR of
+// redis and memcached; it is parsed by the type of out on read. Other simple values are stored as text after a header
+// of three bytes: the marker byte 0xff, the magic byte 'c' and the type of
+// the value, so they read back as the type they were written with. Other
+// values, and items with tags, soft expiration or delta, are stored as a gob
+// encoded Item after the header with the gob encoding type. Untyped text
+// starting with the marker byte is stored after a header too, so it is never
+// taken for an encoded item. Data without header is untyped text, or a gob
+// encoded Item written by previous versions.
+const (
+	encodingMarker byte = 0xff
+	encodingMagic  byte = 'c'
+	encodingGob    byte = 'g' // gob encoded item
+	encodingText   byte = 't' // untyped text starting with the marker byte
+	encodingString byte = 's' // string
+	encodingBytes  byte = 'x' // []byte
+	encodingBool   byte = 'b' // bool
+	encodingTime   byte = 'm' // time.Time in RFC 3339 with nanoseconds
+)
+
+// encodeItem encodes item to the wire format
+func encodeItem(t *Item) (ItemBinary, error) {
+	if t.raw {
+		return encodeText([]byte(t.Val.(string))), nil
+	}
+	if len(t.Tags) == 0 && t.SoftExpiration == 0 && t.Delta == 0 {
+		if typ, text, ok := formatSimple(t.Val); ok {
+			if typ == encodingText {
+				return encodeText(text), nil
+			}
+			return append([]byte{encodingMarker, encodingMagic, typ}, text...), nil
+		}
+	}
+	buf := bytes.NewBuffer([]byte{encodingMarker, encodingMagic, encodingGob})
+	err := gob.NewEncoder(buf).Encode(t)
+	return buf.Bytes(), err
+}
+
+// encodeText returns untyped text, with a header if it starts with the marker byte
+func encodeText(text []byte) ItemBinary {
+	if len(text) == 0 || text[0] != encodingMarker {
+		return text
+	}
+	return append([]byte{encodingMarker, encodingMagic, encodingText}, text...)
+}
+
+// encodeString returns a string value in the wire format
+func encodeString(s string) ItemBinary {
+	return append([]byte{encodingMarker, encodingMagic, encodingString}, s...)
+}
+
+// decodeItem decodes item from the wire format
+func decodeItem(data ItemBinary) (*Item, error) {
+	if len(data) >= 3 && data[0] == encodingMarker && data[1] == encodingMagic {
+		switch data[2] {
+		case encodingGob:
+			return decodeGob(data[3:])
+		case encodingText:
+			return &Item{Val: string(data[3:]), raw: true}, nil
+		default:
+			return decodeTyped(data[2], data[3:])
+		}
+	}
+	// gob encoded item of previous versions, its first message is a type
+	// definition led by its length and a negative type id of 64 or more,
+	// so either starts with a byte never found in utf-8 text but 0x7f
+	if len(data) > 1 && (data[0] >= 0xfe || data[1] >= 0xfe || data[1] == 0x7f) {
+		if item, err := decodeGob(data); err == nil {
+			return item, nil
+		}
+	}
+	return &Item{Val: string(data), raw: true}, nil
+}
+
+// decodeTyped decodes text of a simple value by its encoding type
+func decodeTyped(typ byte, text []byte) (*Item, error) {
+	var err error
+	item := new(Item)
+	switch typ {
+	case encodingString:
+		item.Val = string(text)
+	case encodingBytes:
+		item.Val = text
+	case encodingBool:
+		item.Val, err = strconv.ParseBool(string(text))
+	case encodingTime:
+		item.Val, err = time.Parse(time.RFC3339Nano, string(text))
+	default:
+		return nil, fmt.Errorf("cache: unknown encoding type %q", typ)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cache: cannot decode %q of encoding type %q: %v", text, typ, err)
+	}
+	return item, nil
+}
+
+// decodeGob decodes gob encoded item
+func decodeGob(data []byte) (*Item, error) {
+	item := new(Item)
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// formatSimple returns the encoding type and text of a simple value,
+// the type of a number is encodingText as it is stored untyped
+func formatSimple(v interface{}) (byte, []byte, bool) {
+	switch t := v.(type) {
+	case string:
+		return encodingString, []byte(t), true
+	case []byte:
+		return encodingBytes, t, true
+	case int:
+		return encodingText, strconv.AppendInt(nil, int64(t), 10), true
+	case int8:
+		return encodingText, strconv.AppendInt(nil, int64(t), 10), true
+	case int16:
+		return encodingText, strconv.AppendInt(nil, int64(t), 10), true
+	case int32:
+		return encodingText, strconv.AppendInt(nil, int64(t), 10), true
+	case int64:
+		return encodingText, strconv.AppendInt(nil, t, 10), true
+	case uint:
+		return encodingText, strconv.AppendUint(nil, uint64(t), 10), true
+	case uint8:
+		return encodingText, strconv.AppendUint(nil, uint64(t), 10), true
+	case uint16:
+		return encodingText, strconv.AppendUint(nil, uint64(t), 10), true
+	case uint32:
+		return encodingText, strconv.AppendUint(nil, uint64(t), 10), true
+	case uint64:
+		return encodingText, strconv.AppendUint(nil, t, 10), true
+	case float32:
+		return encodingText, strconv.AppendFloat(nil, float64(t), 'f', -1, 32), true
+	case float64:
+		return encodingText, strconv.AppendFloat(nil, t, 'f', -1, 64), true
+	case bool:
+		return encodingBool, strconv.AppendBool(nil, t), true
+	case time.Time:
+		return encodingTime, []byte(t.Format(time.RFC3339Nano)), true
+	case time.Duration:
+		return encodingText, strconv.AppendInt(nil, int64(t), 10), true
+	default:
+		return 0, nil, false
+	}
+}
+
+// parseText parses untyped text to rv, it is read as text into a string or
+// []byte, and parsed into a number, returns error for other types or if text
+// is not a valid number of the type
+func parseText(text string, rv reflect.Value) error {
+	var err error
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(text)
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("cache: cannot decode text into %v", rv.Type())
+		}
+		rv.SetBytes([]byte(text))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		if n, err = strconv.ParseInt(text, 10, rv.Type().Bits()); err == nil {
+			rv.SetInt(n)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		if n, err = strconv.ParseUint(text, 10, rv.Type().Bits()); err == nil {
+			rv.SetUint(n)
+		}
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(text, rv.Type().Bits()); err == nil {
+			rv.SetFloat(f)
+		}
+	default:
+		return fmt.Errorf("cache: cannot decode text into %v", rv.Type())
+	}
+	if err != nil {
+		return fmt.Errorf("cache: cannot decode %q into %v: %v", text, rv.Type(), err)
+	}
+	return nil
+}
+
+// convertSimple sets a simple value v to rv of another type, a number is
+// converted like untyped text, text converts between string and []byte,
+// returns false if v cannot be converted
+func convertSimple(v interface{}, rv reflect.Value) (bool, error) {
+	typ, text, ok := formatSimple(v)
+	if !ok {
+		return false, nil
+	}
+	switch typ {
+	case encodingText:
+		return true, parseText(string(text), rv)
+	case encodingString, encodingBytes:
+		if rv.Kind() == reflect.String || rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			return true, parseText(string(text), rv)
+		}
+	}
+	return false, nil
+}
+
+func init() {
+	gob.Register(time.Duration(0))
+}
@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCacheEncoding(t *testing.T) {
+	Convey("cache encoding", t, func() {
+		Convey("numbers are untyped text", func() {
+			values := map[interface{}]string{
+				int8(-3):        "-3",
+				uint64(7):       "7",
+				float32(1.1):    "1.1",
+				2.5:             "2.5",
+				time.Second + 1: "1000000001",
+			}
+			for v, text := range values {
+				b, err := NewItem(v, 0).Encode()
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, text)
+			}
+		})
+
+		Convey("other simple values are text with their types", func() {
+			now := time.Date(2016, 5, 1, 12, 30, 0, 123, time.UTC)
+			values := map[interface{}]string{
+				"abc":                "\xff\x63sabc",
+				"5":                  "\xff\x63s5",
+				string([]byte{0xff}): "\xff\x63s\xff",
+				true:                 "\xff\x63btrue",
+				now:                  "\xff\x63m2016-05-01T12:30:00.000000123Z",
+			}
+			for v, text := range values {
+				b, err := NewItem(v, 0).Encode()
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, text)
+			}
+			b, err := NewItem([]byte("raw"), 0).Encode()
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, "\xff\x63xraw")
+
+			var s string
+			So(decode("\xff\x63sabc", &s), ShouldBeNil)
+			So(s, ShouldEqual, "abc")
+			var raw []byte
+			So(decode("\xff\x63xraw", &raw), ShouldBeNil)
+			So(string(raw), ShouldEqual, "raw")
+			So(decode("\xff\x63sabc", &raw), ShouldBeNil)
+			So(string(raw), ShouldEqual, "abc")
+			var ok bool
+			So(decode("\xff\x63btrue", &ok), ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			var tm time.Time
+			So(decode("\xff\x63m2016-05-01T12:30:00Z", &tm), ShouldBeNil)
+			So(tm.Equal(time.Date(2016, 5, 1, 12, 30, 0, 0, time.UTC)), ShouldBeTrue)
+		})
+
+		Convey("decode untyped text by type", func() {
+			var s string
+			So(decode("\xff\x63\x74\xff", &s), ShouldBeNil)
+			So(s, ShouldEqual, "\xff")
+			So(decode("12", &s), ShouldBeNil)
+			So(s, ShouldEqual, "12")
+			var n int16
+			So(decode("-12", &n), ShouldBeNil)
+			So(n, ShouldEqual, -12)
+			var u uint
+			So(decode("12", &u), ShouldBeNil)
+			So(u, ShouldEqual, 12)
+			var f float64
+			So(decode("1.5", &f), ShouldBeNil)
+			So(f, ShouldEqual, 1.5)
+			var raw []byte
+			So(decode("raw", &raw), ShouldBeNil)
+			So(string(raw), ShouldEqual, "raw")
+			var d time.Duration
+			So(decode("1500000000", &d), ShouldBeNil)
+			So(d, ShouldEqual, 1500*time.Millisecond)
+		})
+
+		Convey("parse errors", func() {
+			var n int
+			So(decode("abc", &n), ShouldNotBeNil)
+			So(decode("\xff\x63s5", &n), ShouldNotBeNil)
+			var i8 int8
+			So(decode("300", &i8), ShouldNotBeNil)
+			var u uint
+			So(decode("-1", &u), ShouldNotBeNil)
+			var ok bool
+			So(decode("true", &ok), ShouldNotBeNil)
+			So(decode("\xff\x63byes", &ok), ShouldNotBeNil)
+			var s string
+			So(decode("\xff\x63btrue", &s), ShouldNotBeNil)
+			So(decode("\xff\x63qabc", &s), ShouldNotBeNil)
+			var tm time.Time
+			So(decode("2016-05-01T12:30:00Z", &tm), ShouldNotBeNil)
+			So(decode("\xff\x63mtoday", &tm), ShouldNotBeNil)
+			var m map[string]int
+			So(decode("abc", &m), ShouldNotBeNil)
+		})
+
+		Convey("convert between simple types", func() {
+			item := &Item{Val: int64(5)}
+			var n int
+			So(item.Decode(&n), ShouldBeNil)
+			So(n, ShouldEqual, 5)
+			var s string
+			So(item.Decode(&s), ShouldBeNil)
+			So(s, ShouldEqual, "5")
+			item = &Item{Val: "5"}
+			So(item.Decode(&n), ShouldNotBeNil)
+			var raw []byte
+			So(item.Decode(&raw), ShouldBeNil)
+			So(string(raw), ShouldEqual, "5")
+		})
+
+		Convey("other values are gob items", func() {
+			type user struct {
+				Name string
+			}
+			gob.Register(user{})
+			b, err := NewItem(user{"baa"}, 10).Encode()
+			So(err, ShouldBeNil)
+			So(string(b[:3]), ShouldEqual, "\xff\x63\x67")
+			item, err := b.Item()
+			So(err, ShouldBeNil)
+			var u user
+			So(item.Decode(&u), ShouldBeNil)
+			So(u.Name, ShouldEqual, "baa")
+			So(item.TTL, ShouldEqual, 10)
+
+			item = NewItem("tagged", 10)
+			item.Tags = map[string]int64{"tag": 1}
+			b, err = item.Encode()
+			So(err, ShouldBeNil)
+			item, err = b.Item()
+			So(err, ShouldBeNil)
+			So(item.Tags["tag"], ShouldEqual, 1)
+			var tagged string
+			So(item.Decode(&tagged), ShouldBeNil)
+			So(tagged, ShouldEqual, "tagged")
+		})
+
+		Convey("legacy gob items", func() {
+			buf := bytes.NewBuffer(nil)
+			err := gob.NewEncoder(buf).Encode(NewItem(int64(3), 0))
+			So(err, ShouldBeNil)
+			item, err := ItemBinary(buf.Bytes()).Item()
+			So(err, ShouldBeNil)
+			var n int64
+			So(item.Decode(&n), ShouldBeNil)
+			So(n, ShouldEqual, 3)
+		})
+	})
+}
+
+// decode decodes data of the wire format to out
+func decode(data string, out interface{}) error {
+	item, err := ItemBinary(data).Item()
+	if err != nil {
+		return err
+	}
+	return item.Decode(out)
+}
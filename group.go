@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+)
+
+// group merges concurrent calls of a key into one, for Loader and Typed.
+// A call runs in background, a panic of it is returned as the error of the call.
+type group[T any] struct {
+	mu    sync.Mutex
+	calls map[string]*groupCall[T]
+}
+
+// groupCall a running call of a key
+type groupCall[T any] struct {
+	done       chan struct{}
+	val        T
+	err        error
+	background bool // no caller waits for it, guarded by mu of group
+}
+
+// do starts fn for key in background, or returns the running call of key.
+// A caller not in background waits for done of the call, the error of
+// a call no caller waits for is passed to onError, nil to ignore it.
+func (g *group[T]) do(key string, background bool, fn func() (T, error), onError func(err error)) *groupCall[T] {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if call, ok := g.calls[key]; ok {
+		if !background {
+			call.background = false
+		}
+		return call
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*groupCall[T])
+	}
+	call := &groupCall[T]{done: make(chan struct{}), background: background}
+	g.calls[key] = call
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				var zero T
+				call.val, call.err = zero, fmt.Errorf("cache: load %s panic: %v", key, r)
+			}
+			g.mu.Lock()
+			delete(g.calls, key)
+			background := call.background
+			g.mu.Unlock()
+			close(call.done)
+			if background && call.err != nil && onError != nil {
+				onError(call.err)
+			}
+		}()
+		call.val, call.err = fn()
+	}()
+	return call
+}
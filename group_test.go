@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCacheGroup(t *testing.T) {
+	Convey("cache group", t, func() {
+		var g group[int]
+		var calls int64
+		fn := func() (int, error) {
+			atomic.AddInt64(&calls, 1)
+			time.Sleep(time.Millisecond * 50)
+			return 1, nil
+		}
+
+		Convey("merge calls of a key", func() {
+			var wg sync.WaitGroup
+			values := make([]int, 10)
+			for i := range values {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					call := g.do("key", false, fn, nil)
+					<-call.done
+					values[i] = call.val
+				}(i)
+			}
+			wg.Wait()
+			for _, v := range values {
+				So(v, ShouldEqual, 1)
+			}
+			So(atomic.LoadInt64(&calls), ShouldEqual, 1)
+			So(g.calls, ShouldBeEmpty)
+		})
+
+		Convey("panic as error", func() {
+			call := g.do("key", false, func() (int, error) {
+				panic("boom")
+			}, nil)
+			<-call.done
+			So(call.err, ShouldNotBeNil)
+			So(call.err.Error(), ShouldContainSubstring, "boom")
+			So(g.calls, ShouldBeEmpty)
+		})
+
+		Convey("errors of background calls", func() {
+			errs := make(chan error, 2)
+			onError := func(err error) { errs <- err }
+			fail := func() (int, error) {
+				time.Sleep(time.Millisecond * 50)
+				return 0, errors.New("failed")
+			}
+			<-g.do("background", true, fail, onError).done
+			// a caller waits for the call joined
+			g.do("waited", true, fail, onError)
+			<-g.do("waited", false, fail, onError).done
+			select {
+			case err := <-errs:
+				So(err.Error(), ShouldEqual, "failed")
+			case <-time.After(time.Second):
+				So("no error reported", ShouldBeEmpty)
+			}
+			So(len(errs), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,25 @@
+package httpcache
+
+import (
+	"net/http"
+
+	"github.com/go-baa/baa"
+)
+
+// Middleware returns a baa middleware caching responses of the handlers after it,
+// a response from the cache breaks the handlers chain. The handlers write to
+// a response of their own during the chain, so status, header and body of
+// theirs are all recorded, the cached response is written to the client one.
+func Middleware(h *Cache) baa.HandlerFunc {
+	return func(c *baa.Context) {
+		resp := c.Resp
+		hit := h.serve(resp, c.Req, func(w http.ResponseWriter) {
+			defer func() { c.Resp = resp }()
+			c.Resp = baa.NewResponse(w, c.Baa())
+			c.Next()
+		})
+		if hit {
+			c.Break()
+		}
+	}
+}
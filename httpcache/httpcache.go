@@ -0,0 +1,422 @@
+// Package httpcache providers a middleware caching full GET and HEAD responses
+// in cacher, for net/http and baa.
+package httpcache
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-baa/cache"
+)
+
+// DefaultMaxSize is the default maximum body bytes of a cached response
+const DefaultMaxSize = 1 << 20
+
+// Options cache middleware options
+type Options struct {
+	TTL     time.Duration // time to cache a response without max-age or s-maxage, 0 for not caching it
+	Vary    []string      // request headers the responses vary by, they are a part of the key
+	Rules   []Rule        // ttl and bypass rules of routes, the first matched rule is used
+	MaxSize int64         // maximum body bytes of a cached response, default 1MB
+}
+
+// Rule ttl or bypass of the requests it matches
+type Rule struct {
+	Path   string                   // path pattern of path.Match, like /api/*
+	Match  func(*http.Request) bool // custom matcher, used if Path is empty
+	TTL    time.Duration            // ttl of the matched responses without max-age or s-maxage
+	Bypass bool                     // the matched requests are not cached
+}
+
+// match reports whether the rule matches r
+func (rule *Rule) match(r *http.Request) bool {
+	if rule.Path != "" {
+		ok, _ := path.Match(rule.Path, r.URL.Path)
+		return ok
+	}
+	return rule.Match != nil && rule.Match(r)
+}
+
+// Cache caches responses in a cacher
+type Cache struct {
+	c   cache.Cacher
+	opt Options
+}
+
+// New create a response cache storing responses in c,
+// use a namespace of the cacher to keep its keys apart
+func New(c cache.Cacher, o Options) *Cache {
+	if o.MaxSize <= 0 {
+		o.MaxSize = DefaultMaxSize
+	}
+	vary := make([]string, len(o.Vary))
+	for i, h := range o.Vary {
+		vary[i] = http.CanonicalHeaderKey(h)
+	}
+	sort.Strings(vary)
+	o.Vary = vary
+	return &Cache{c: c, opt: o}
+}
+
+// Handler returns a net/http middleware caching responses of next
+func (h *Cache) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, func(w http.ResponseWriter) {
+			next.ServeHTTP(w, r)
+		})
+	})
+}
+
+// entry a cached response
+type entry struct {
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Created int64 // stored time in unix second
+}
+
+// serve answers r from the cache, or by next and caches the response,
+// returns true if it is answered from the cache
+func (h *Cache) serve(w http.ResponseWriter, r *http.Request, next func(w http.ResponseWriter)) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		next(w)
+		return false
+	}
+	rule := h.rule(r)
+	cc := parseCacheControl(r.Header.Get("Cache-Control"))
+	if (rule != nil && rule.Bypass) || r.Header.Get("Authorization") != "" || cc.has("no-store") {
+		next(w)
+		return false
+	}
+
+	key := h.key(r)
+	revalidate := cc.has("no-cache") || cc["max-age"] == "0" || r.Header.Get("Pragma") == "no-cache"
+	if !revalidate {
+		var e entry
+		if err := h.c.Get(key, &e); err == nil {
+			e.Header.Set("Age", strconv.FormatInt(time.Now().Unix()-e.Created, 10))
+			e.Header.Set("X-Cache", "HIT")
+			e.write(w, r)
+			return true
+		}
+	}
+
+	ttl := h.opt.TTL
+	if rule != nil && rule.TTL > 0 {
+		ttl = rule.TTL
+	}
+	w.Header().Set("X-Cache", "MISS")
+	rec := &recorder{w: w, h: h, ttl: ttl, before: w.Header().Clone()}
+	next(rec)
+	if rec.pass {
+		return false
+	}
+	if !rec.wrote {
+		rec.WriteHeader(http.StatusOK)
+		if rec.pass {
+			return false
+		}
+	}
+
+	e := &entry{
+		Status:  rec.status,
+		Header:  storedHeader(rec.header),
+		Body:    rec.buf.Bytes(),
+		Created: time.Now().Unix(),
+	}
+	e.validators()
+	h.c.Set(key, e, int64((rec.ttl+time.Second-1)/time.Second))
+	e.write(w, r)
+	return false
+}
+
+// rule returns the first rule matching r, nil if none
+func (h *Cache) rule(r *http.Request) *Rule {
+	for i := range h.opt.Rules {
+		if h.opt.Rules[i].match(r) {
+			return &h.opt.Rules[i]
+		}
+	}
+	return nil
+}
+
+// key returns the cache key of r, by method, host, path, sorted query and vary headers
+func (h *Cache) key(r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte(' ')
+	b.WriteString(r.Host)
+	b.WriteString(r.URL.Path)
+	query := r.URL.Query()
+	for _, values := range query {
+		sort.Strings(values)
+	}
+	if len(query) > 0 {
+		// Encode sorts by key
+		b.WriteByte('?')
+		b.WriteString(query.Encode())
+	}
+	for _, name := range h.opt.Vary {
+		b.WriteByte('\n')
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	sum := sha1.Sum([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// cacheable returns the ttl to cache a response by its status and the header
+// set by the handler, 0 if it must not be cached
+func (h *Cache) cacheable(status int, header http.Header, ttl time.Duration) time.Duration {
+	switch status {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent,
+		http.StatusMultipleChoices, http.StatusMovedPermanently, http.StatusNotFound,
+		http.StatusMethodNotAllowed, http.StatusGone, http.StatusRequestURITooLong,
+		http.StatusNotImplemented:
+	default:
+		return 0
+	}
+	if header.Get("Set-Cookie") != "" {
+		return 0
+	}
+	// a response varying by headers out of the key cannot be cached
+	for _, field := range header.Values("Vary") {
+		for _, name := range strings.Split(field, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			i := sort.SearchStrings(h.opt.Vary, name)
+			if i == len(h.opt.Vary) || h.opt.Vary[i] != name {
+				return 0
+			}
+		}
+	}
+
+	cc := parseCacheControl(header.Get("Cache-Control"))
+	if cc.has("no-store") || cc.has("private") || cc.has("no-cache") {
+		return 0
+	}
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if v, ok := cc[directive]; ok {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n <= 0 {
+				return 0
+			}
+			return time.Duration(n) * time.Second
+		}
+	}
+	return ttl
+}
+
+// validators generates the ETag and Last-Modified of the entry if not set,
+// and the Content-Type detected like net/http
+func (e *entry) validators() {
+	if _, ok := e.Header["Content-Type"]; !ok && len(e.Body) > 0 {
+		e.Header.Set("Content-Type", http.DetectContentType(e.Body))
+	}
+	if e.Header.Get("ETag") == "" {
+		sum := sha1.Sum(e.Body)
+		e.Header.Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	}
+	if e.Header.Get("Last-Modified") == "" {
+		e.Header.Set("Last-Modified", time.Unix(e.Created, 0).UTC().Format(http.TimeFormat))
+	}
+}
+
+// write writes the entry to w, or 304 if the conditional request r matches it
+func (e *entry) write(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	for k, v := range e.Header {
+		header[k] = v
+	}
+	if e.Status == http.StatusOK && notModified(r, e.Header) {
+		for _, k := range []string{"Content-Type", "Content-Length"} {
+			header.Del(k)
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if e.Status != http.StatusNoContent {
+		header.Set("Content-Length", strconv.Itoa(len(e.Body)))
+	}
+	w.WriteHeader(e.Status)
+	if r.Method != http.MethodHead {
+		w.Write(e.Body)
+	}
+}
+
+// notModified reports whether the conditional request r matches the response header,
+// If-None-Match is used before If-Modified-Since
+func notModified(r *http.Request, header http.Header) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := strings.TrimPrefix(header.Get("ETag"), "W/")
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(header.Get("Last-Modified"))
+	return err == nil && !modified.After(ims)
+}
+
+// hopHeaders the headers of a connection or a client, they are not cached
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade", "X-Cache", "Age", "Set-Cookie",
+}
+
+// storedHeader returns a copy of header without the hop-by-hop headers
+func storedHeader(header http.Header) http.Header {
+	h := header.Clone()
+	for _, k := range hopHeaders {
+		h.Del(k)
+	}
+	return h
+}
+
+// changedHeader returns the headers of after added or changed since before,
+// headers set by middlewares before the cache are set again on a hit
+func changedHeader(before, after http.Header) http.Header {
+	h := make(http.Header)
+	for k, v := range after {
+		if old, ok := before[k]; ok && equalValues(old, v) {
+			continue
+		}
+		h[k] = append([]string(nil), v...)
+	}
+	return h
+}
+
+// equalValues reports whether the values of a header are the same
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// cacheControl the directives of a Cache-Control header
+type cacheControl map[string]string
+
+// parseCacheControl parses the directives of a Cache-Control header
+func parseCacheControl(s string) cacheControl {
+	cc := cacheControl{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value := part, ""
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			name, value = part[:i], strings.Trim(part[i+1:], `"`)
+		}
+		cc[strings.ToLower(strings.TrimSpace(name))] = value
+	}
+	return cc
+}
+
+// has reports whether the directive is present
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// recorder buffers a cacheable response, a response found not cacheable,
+// larger than the max size or flushed is passed through to the client
+type recorder struct {
+	w      http.ResponseWriter
+	h      *Cache
+	ttl    time.Duration
+	before http.Header // the header before the handler
+	header http.Header // the header set by the handler
+	status int
+	buf    bytes.Buffer
+	wrote  bool // the header is written
+	pass   bool // the response is passed through
+}
+
+// Header returns the header of the client response
+func (rec *recorder) Header() http.Header {
+	return rec.w.Header()
+}
+
+// WriteHeader decides whether to cache the response by its status and header
+func (rec *recorder) WriteHeader(status int) {
+	if rec.wrote {
+		return
+	}
+	rec.wrote = true
+	rec.status = status
+	rec.header = changedHeader(rec.before, rec.w.Header())
+	rec.ttl = rec.h.cacheable(status, rec.header, rec.ttl)
+	if rec.ttl <= 0 {
+		rec.pass = true
+		rec.w.WriteHeader(status)
+	}
+}
+
+// Write buffers body of a cacheable response
+func (rec *recorder) Write(b []byte) (int, error) {
+	if !rec.wrote {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if rec.pass {
+		return rec.w.Write(b)
+	}
+	if int64(rec.buf.Len()+len(b)) > rec.h.opt.MaxSize {
+		// too large to cache, write what is buffered and pass the rest
+		if err := rec.passThrough(); err != nil {
+			return 0, err
+		}
+		return rec.w.Write(b)
+	}
+	return rec.buf.Write(b)
+}
+
+// Flush passes the response through and flushes it, a streamed response is not cached
+func (rec *recorder) Flush() {
+	if !rec.wrote {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if !rec.pass && rec.passThrough() != nil {
+		return
+	}
+	if f, ok := rec.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// passThrough writes the header and what is buffered to the client,
+// the rest of the response is written to it directly
+func (rec *recorder) passThrough() error {
+	rec.pass = true
+	rec.w.WriteHeader(rec.status)
+	_, err := rec.w.Write(rec.buf.Bytes())
+	return err
+}
+
+func init() {
+	gob.Register(entry{})
+}
@@ -0,0 +1,295 @@
+package httpcache
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-baa/baa"
+	"github.com/go-baa/cache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHTTPCache(t *testing.T) {
+	Convey("http cache", t, func() {
+		c := cache.New(cache.Options{
+			Name:    "testHTTPCache",
+			Adapter: "memory",
+		}).Namespace("http")
+		c.Flush()
+
+		var calls int64
+		mux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt64(&calls, 1)
+			if v := r.URL.Query().Get("cc"); v != "" {
+				w.Header().Set("Cache-Control", v)
+			}
+			if v := r.URL.Query().Get("vary"); v != "" {
+				w.Header().Set("Vary", v)
+			}
+			if r.URL.Query().Get("cookie") != "" {
+				http.SetCookie(w, &http.Cookie{Name: "a", Value: "1"})
+			}
+			if r.URL.Query().Get("error") != "" {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			fmt.Fprintf(w, "%s %d %s", r.URL.Path, n, r.Header.Get("Accept-Language"))
+		})
+		mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&calls, 1)
+			w.Write([]byte(strings.Repeat("a", 60)))
+			w.Write([]byte(strings.Repeat("b", 60)))
+		})
+		mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&calls, 1)
+			w.Write([]byte("a"))
+			w.(http.Flusher).Flush()
+			w.Write([]byte("b"))
+		})
+		mux.HandleFunc("/header", func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&calls, 1)
+			w.Header().Set("X-Handler", "1")
+			w.Header().Set("X-Changed", "handler")
+			w.Write([]byte("header"))
+		})
+		mux.HandleFunc("/etag", func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&calls, 1)
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte("v1"))
+		})
+		responses := New(c, Options{
+			TTL:     time.Minute,
+			Vary:    []string{"accept-language"},
+			MaxSize: 100,
+			Rules: []Rule{
+				{Path: "/admin/*", Bypass: true},
+				{Path: "/static/*", TTL: time.Hour},
+				{Match: func(r *http.Request) bool { return r.URL.Query().Get("fresh") != "" }, Bypass: true},
+			},
+		})
+		handler := responses.Handler(mux)
+
+		get := func(target string, header ...string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", target, nil)
+			for i := 0; i+1 < len(header); i += 2 {
+				r.Header.Set(header[i], header[i+1])
+			}
+			handler.ServeHTTP(w, r)
+			return w
+		}
+
+		Convey("miss and hit", func() {
+			w := get("/a")
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Body.String(), ShouldEqual, "/a 1 ")
+			So(w.Header().Get("X-Cache"), ShouldEqual, "MISS")
+			So(w.Header().Get("ETag"), ShouldNotBeEmpty)
+			So(w.Header().Get("Last-Modified"), ShouldNotBeEmpty)
+
+			w2 := get("/a")
+			So(w2.Body.String(), ShouldEqual, "/a 1 ")
+			So(w2.Header().Get("X-Cache"), ShouldEqual, "HIT")
+			So(w2.Header().Get("ETag"), ShouldEqual, w.Header().Get("ETag"))
+			So(w2.Header().Get("Age"), ShouldNotBeEmpty)
+			So(w2.Header().Get("Content-Type"), ShouldStartWith, "text/plain")
+			So(atomic.LoadInt64(&calls), ShouldEqual, 1)
+
+			w = httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("HEAD", "/a", nil))
+			So(w.Body.Len(), ShouldEqual, 0)
+			So(atomic.LoadInt64(&calls), ShouldEqual, 2)
+		})
+
+		Convey("key", func() {
+			get("/q?x=1&y=2&y=1")
+			So(get("/q?y=1&x=1&y=2").Body.String(), ShouldEqual, "/q 1 ")
+			So(get("/q?x=2").Body.String(), ShouldEqual, "/q 2 ")
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "http://other.example/q?x=2", nil)
+			handler.ServeHTTP(w, r)
+			So(w.Body.String(), ShouldEqual, "/q 3 ")
+			So(get("/q?x=2").Body.String(), ShouldEqual, "/q 2 ")
+
+			So(get("/v", "Accept-Language", "en").Body.String(), ShouldEqual, "/v 4 en")
+			So(get("/v", "Accept-Language", "zh").Body.String(), ShouldEqual, "/v 5 zh")
+			So(get("/v", "Accept-Language", "en").Body.String(), ShouldEqual, "/v 4 en")
+
+			// varying by a header out of the key
+			get("/v?vary=Cookie")
+			So(get("/v?vary=Cookie").Body.String(), ShouldEqual, "/v 7 ")
+			get("/v?vary=Accept-Language")
+			So(get("/v?vary=Accept-Language").Body.String(), ShouldEqual, "/v 8 ")
+		})
+
+		Convey("cache control", func() {
+			get("/cc?cc=no-store")
+			So(get("/cc?cc=no-store").Body.String(), ShouldEqual, "/cc 2 ")
+			get("/cc?cc=private")
+			So(get("/cc?cc=private").Body.String(), ShouldEqual, "/cc 4 ")
+
+			get("/cc?cc=max-age=1")
+			So(get("/cc?cc=max-age=1").Body.String(), ShouldEqual, "/cc 5 ")
+			get("/cc?cc=max-age=100,s-maxage=1")
+			So(get("/cc?cc=max-age=100,s-maxage=1").Body.String(), ShouldEqual, "/cc 6 ")
+			time.Sleep(time.Millisecond * 1100)
+			So(get("/cc?cc=max-age=1").Body.String(), ShouldEqual, "/cc 7 ")
+			So(get("/cc?cc=max-age=100,s-maxage=1").Body.String(), ShouldEqual, "/cc 8 ")
+
+			// the client asks to revalidate
+			get("/r")
+			So(get("/r", "Cache-Control", "no-cache").Body.String(), ShouldEqual, "/r 10 ")
+			So(get("/r").Body.String(), ShouldEqual, "/r 10 ")
+			So(get("/r", "Cache-Control", "no-store").Body.String(), ShouldEqual, "/r 11 ")
+		})
+
+		Convey("not cached", func() {
+			for _, target := range []string{"/admin/users", "/a?fresh=1", "/a?cookie=1", "/a?error=1"} {
+				get(target)
+				So(get(target).Header().Get("X-Cache"), ShouldNotEqual, "HIT")
+			}
+			So(atomic.LoadInt64(&calls), ShouldEqual, 8)
+
+			w := get("/large")
+			So(w.Body.String(), ShouldEqual, strings.Repeat("a", 60)+strings.Repeat("b", 60))
+			get("/large")
+			So(atomic.LoadInt64(&calls), ShouldEqual, 10)
+
+			get("/b", "Authorization", "Basic YTpi")
+			get("/b", "Authorization", "Basic YTpi")
+			So(atomic.LoadInt64(&calls), ShouldEqual, 12)
+
+			w = httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("POST", "/b", nil))
+			handler.ServeHTTP(w, httptest.NewRequest("POST", "/b", nil))
+			So(atomic.LoadInt64(&calls), ShouldEqual, 14)
+		})
+
+		Convey("flushed responses", func() {
+			for i := 0; i < 2; i++ {
+				w := get("/stream")
+				So(w.Body.String(), ShouldEqual, "ab")
+				So(w.Flushed, ShouldBeTrue)
+			}
+			So(atomic.LoadInt64(&calls), ShouldEqual, 2)
+		})
+
+		Convey("headers of the handler", func() {
+			// an outer middleware sets headers and a cookie of every request
+			var id int64
+			outer := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Request-Id", fmt.Sprint(atomic.AddInt64(&id, 1)))
+				w.Header().Set("X-Changed", "outer")
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "1"})
+				handler.ServeHTTP(w, r)
+			})
+			for i := 1; i <= 2; i++ {
+				w := httptest.NewRecorder()
+				outer.ServeHTTP(w, httptest.NewRequest("GET", "/header", nil))
+				So(w.Body.String(), ShouldEqual, "header")
+				So(w.Header().Values("X-Request-Id"), ShouldResemble, []string{fmt.Sprint(i)})
+				So(w.Header().Values("Set-Cookie"), ShouldHaveLength, 1)
+				So(w.Header().Get("X-Handler"), ShouldEqual, "1")
+				So(w.Header().Get("X-Changed"), ShouldEqual, "handler")
+			}
+			So(atomic.LoadInt64(&calls), ShouldEqual, 1)
+
+			var e entry
+			So(c.Get(responses.key(httptest.NewRequest("GET", "/header", nil)), &e), ShouldBeNil)
+			So(e.Header.Get("X-Request-Id"), ShouldBeEmpty)
+			So(e.Header.Get("Set-Cookie"), ShouldBeEmpty)
+			So(e.Header.Get("X-Handler"), ShouldEqual, "1")
+		})
+
+		Convey("rule ttl", func() {
+			h := New(c, Options{Rules: []Rule{{Path: "/static/*", TTL: time.Hour}}}).Handler(mux)
+			for i := 0; i < 2; i++ {
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/static/app.js", nil))
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/page", nil))
+			}
+			So(atomic.LoadInt64(&calls), ShouldEqual, 3)
+		})
+
+		Convey("conditional requests", func() {
+			w := get("/c")
+			etag := w.Header().Get("ETag")
+			modified := w.Header().Get("Last-Modified")
+
+			w = get("/c", "If-None-Match", `"other", `+etag)
+			So(w.Code, ShouldEqual, http.StatusNotModified)
+			So(w.Body.Len(), ShouldEqual, 0)
+			So(w.Header().Get("ETag"), ShouldEqual, etag)
+			So(get("/c", "If-None-Match", `"other"`).Code, ShouldEqual, http.StatusOK)
+
+			So(get("/c", "If-Modified-Since", modified).Code, ShouldEqual, http.StatusNotModified)
+			past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+			So(get("/c", "If-Modified-Since", past).Code, ShouldEqual, http.StatusOK)
+
+			// a fresh response answers conditional requests too
+			So(get("/etag", "If-None-Match", `"v1"`).Code, ShouldEqual, http.StatusNotModified)
+			So(atomic.LoadInt64(&calls), ShouldEqual, 2)
+		})
+	})
+}
+
+func TestHTTPCacheMiddleware(t *testing.T) {
+	Convey("http cache baa middleware", t, func() {
+		c := cache.New(cache.Options{
+			Name:    "testHTTPCacheMiddleware",
+			Adapter: "memory",
+		})
+		var calls int64
+		app := baa.New()
+		app.Use(Middleware(New(c, Options{TTL: time.Minute})))
+		app.Get("/", func(c *baa.Context) {
+			atomic.AddInt64(&calls, 1)
+			c.Resp.Write([]byte("baa"))
+		})
+
+		for i := 0; i < 2; i++ {
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			So(w.Body.String(), ShouldEqual, "baa")
+		}
+		So(atomic.LoadInt64(&calls), ShouldEqual, 1)
+
+		app.Get("/created", func(c *baa.Context) {
+			atomic.AddInt64(&calls, 1)
+			c.Resp.Header().Set("X-Test", "1")
+			c.Resp.Header().Set("Cache-Control", "max-age=60")
+			c.String(http.StatusNonAuthoritativeInfo, "created")
+		})
+		for i, cached := range []string{"MISS", "HIT"} {
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest("GET", "/created", nil))
+			So(w.Code, ShouldEqual, http.StatusNonAuthoritativeInfo)
+			So(w.Header().Get("X-Test"), ShouldEqual, "1")
+			So(w.Header().Get("X-Cache"), ShouldEqual, cached)
+			So(w.Body.String(), ShouldEqual, "created")
+			So(atomic.LoadInt64(&calls), ShouldEqual, 2)
+			if i == 1 {
+				So(w.Header().Get("Age"), ShouldNotBeEmpty)
+			}
+		}
+
+		// not cacheable, passed through
+		app.Get("/private", func(c *baa.Context) {
+			atomic.AddInt64(&calls, 1)
+			c.Resp.Header().Set("Cache-Control", "private")
+			c.String(http.StatusAccepted, "private")
+		})
+		for i := 0; i < 2; i++ {
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest("GET", "/private", nil))
+			So(w.Code, ShouldEqual, http.StatusAccepted)
+			So(w.Body.String(), ShouldEqual, "private")
+		}
+		So(atomic.LoadInt64(&calls), ShouldEqual, 4)
+	})
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Jitter takes a random part off ttl, so keys set together with one ttl
+// do not expire at the same second. A ttl is never extended by jitter.
+type Jitter struct {
+	percent int
+	mu      sync.Mutex
+	rand    *rand.Rand
+}
+
+// NewJitter create a jitter by options Jitter and JitterSeed,
+// returns nil if Jitter is 0, a nil jitter keeps ttl
+func NewJitter(o Options) (*Jitter, error) {
+	if o.Jitter < 0 || o.Jitter > 100 {
+		return nil, fmt.Errorf("cache: jitter must be a percent from 0 to 100, got %d", o.Jitter)
+	}
+	if o.Jitter == 0 {
+		return nil, nil
+	}
+	seed := o.JitterSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Jitter{
+		percent: o.Jitter,
+		rand:    rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+// TTL returns ttl second less a random part up to the jitter percent,
+// at least one second, a ttl without expiration is kept
+func (j *Jitter) TTL(ttl int64) int64 {
+	if j == nil || ttl <= 0 {
+		return ttl
+	}
+	if ttl = j.cut(ttl); ttl < 1 {
+		return 1
+	}
+	return ttl
+}
+
+// Duration returns ttl less a random part up to the jitter percent like TTL,
+// for ttl of locks, at least one millisecond, a ttl without expiration is kept
+func (j *Jitter) Duration(ttl time.Duration) time.Duration {
+	if j == nil || ttl <= time.Millisecond {
+		return ttl
+	}
+	if ttl = time.Duration(j.cut(int64(ttl))); ttl < time.Millisecond {
+		return time.Millisecond
+	}
+	return ttl
+}
+
+// NewItem create a cache item like NewItem with ttl second taken off by TTL
+func (j *Jitter) NewItem(val interface{}, ttl int64) *Item {
+	return NewItem(val, j.TTL(ttl))
+}
+
+// cut returns v less a random part up to the jitter percent
+func (j *Jitter) cut(v int64) int64 {
+	n := v * int64(j.percent) / 100
+	if n <= 0 {
+		return v
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return v - j.rand.Int63n(n+1)
+}
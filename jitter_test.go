@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCacheJitter(t *testing.T) {
+	Convey("cache jitter", t, func() {
+		Convey("ttl", func() {
+			j, err := NewJitter(Options{Jitter: 20, JitterSeed: 1})
+			So(err, ShouldBeNil)
+			seen := make(map[int64]bool)
+			for i := 0; i < 100; i++ {
+				ttl := j.TTL(100)
+				So(ttl, ShouldBeBetweenOrEqual, 80, 100)
+				seen[ttl] = true
+			}
+			So(len(seen), ShouldBeGreaterThan, 1)
+			So(j.TTL(0), ShouldEqual, 0)
+			So(j.TTL(-1), ShouldEqual, -1)
+			So(j.TTL(4), ShouldEqual, 4)
+
+			// same seed, same ttl
+			j1, _ := NewJitter(Options{Jitter: 50, JitterSeed: 7})
+			j2, _ := NewJitter(Options{Jitter: 50, JitterSeed: 7})
+			for i := 0; i < 10; i++ {
+				So(j1.TTL(3600), ShouldEqual, j2.TTL(3600))
+			}
+
+			j, _ = NewJitter(Options{Jitter: 100})
+			for i := 0; i < 10; i++ {
+				So(j.TTL(2), ShouldBeGreaterThanOrEqualTo, 1)
+			}
+		})
+
+		Convey("duration", func() {
+			j, _ := NewJitter(Options{Jitter: 20, JitterSeed: 1})
+			for i := 0; i < 10; i++ {
+				So(j.Duration(time.Second), ShouldBeBetweenOrEqual, 800*time.Millisecond, time.Second)
+			}
+			So(j.Duration(0), ShouldEqual, 0)
+			So(j.Duration(time.Millisecond), ShouldEqual, time.Millisecond)
+			j, _ = NewJitter(Options{Jitter: 100})
+			for i := 0; i < 10; i++ {
+				So(j.Duration(2*time.Millisecond), ShouldBeGreaterThanOrEqualTo, time.Millisecond)
+			}
+			var none *Jitter
+			So(none.Duration(time.Second), ShouldEqual, time.Second)
+			So(none.NewItem("1", 10).TTL, ShouldEqual, 10)
+		})
+
+		Convey("options", func() {
+			j, err := NewJitter(Options{})
+			So(err, ShouldBeNil)
+			So(j, ShouldBeNil)
+			So(j.TTL(10), ShouldEqual, 10)
+
+			_, err = NewJitter(Options{Jitter: 101})
+			So(err, ShouldNotBeNil)
+			_, err = NewCacher("memory", Options{Jitter: -1})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("memory set", func() {
+			c := New(Options{
+				Name:       "testJitter",
+				Adapter:    "memory",
+				Jitter:     50,
+				JitterSeed: 1,
+			})
+			m := c.(*Memory)
+			ttl := func(key string) int64 {
+				v, ok := m.store.Get(key)
+				So(ok, ShouldBeTrue)
+				return (v.(*memoryEntry).expiration - time.Now().UnixNano() + 5e8) / 1e9
+			}
+			ttls := make(map[int64]bool)
+			for _, key := range []string{"a", "b", "c", "d", "e"} {
+				c.Set(key, "1", 100)
+				So(ttl(key), ShouldBeBetweenOrEqual, 50, 100)
+				ttls[ttl(key)] = true
+			}
+			So(len(ttls), ShouldBeGreaterThan, 1)
+
+			// counters and locks
+			for _, key := range []string{"a", "b", "c", "d", "e"} {
+				c.IncrWithTTL("counter:"+key, 1, 100)
+				So(ttl("counter:"+key), ShouldBeBetweenOrEqual, 50, 100)
+				ttls[ttl("counter:"+key)] = true
+				m.SetNX("lock:"+key, "1", 100*time.Second)
+				So(ttl("lock:"+key), ShouldBeBetweenOrEqual, 50, 100)
+			}
+			So(m.Jitter(), ShouldNotBeNil)
+		})
+
+		Convey("loader deadlines", func() {
+			c := New(Options{
+				Name:       "testJitterLoader",
+				Adapter:    "memory",
+				Jitter:     50,
+				JitterSeed: 1,
+			})
+			softs := make(map[int64]bool)
+			for _, key := range []string{"a", "b", "c", "d", "e"} {
+				So(SetStale(c, key, "1", 100, 200), ShouldBeNil)
+				var v string
+				item, err := getItem(c, key, &v)
+				So(err, ShouldBeNil)
+				soft := (item.SoftExpiration - time.Now().UnixNano() + 5e8) / 1e9
+				hard := (item.Expiration - time.Now().UnixNano() + 5e8) / 1e9
+				So(soft, ShouldBeBetweenOrEqual, 50, 100)
+				So(hard, ShouldBeBetweenOrEqual, 100, 200)
+				softs[soft] = true
+			}
+			So(len(softs), ShouldBeGreaterThan, 1)
+		})
+	})
+}
@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// LoadFunc loads the value of given key from the source of cached data, like a database
+type LoadFunc func(key string) (interface{}, error)
+
+// Loader reads values through a cacher with stale-while-revalidate.
+// A value loaded is fresh for TTL seconds, then stale until HardTTL seconds.
+// Get returns a stale value immediately and refreshes it by Load in background,
+// it calls Load and waits only on a miss. Concurrent loads of a key are merged
+// into one call, so an expired hot key is loaded once.
+//
+// With Beta set, a fresh value is refreshed early by the XFetch algorithm,
+// so app instances sharing a cache do not load a hot key at the same time.
+// The time spent by Load is stored with the value, a Get refreshes it in
+// background with a chance rising as the deadline approaches, higher for
+// a value slower to load and a greater Beta, 1 is a good start.
+type Loader struct {
+	Cacher  Cacher
+	Load    LoadFunc
+	TTL     int64   // soft ttl second, the value is stale after it
+	HardTTL int64   // hard ttl second, the value is a miss after it, 0 for never
+	Beta    float64 // early refresh factor of XFetch, 0 for off
+	// OnError is called with the error of a background refresh, which no
+	// caller waits for, nil to ignore them
+	OnError func(key string, err error)
+
+	calls group[interface{}]
+}
+
+// NewLoader create a loader reading through c, values are loaded by load
+func NewLoader(c Cacher, load LoadFunc, ttl, hardTTL int64) *Loader {
+	return &Loader{
+		Cacher:  c,
+		Load:    load,
+		TTL:     ttl,
+		HardTTL: hardTTL,
+	}
+}
+
+// Get returns value to out by given key, a stale value is returned
+// and refreshed in background, a missing value is loaded and cached
+func (l *Loader) Get(key string, out interface{}) error {
+	item, err := getItem(l.Cacher, key, out)
+	if err == nil {
+		if item.Stale() || l.early(item) {
+			l.do(key, true)
+		}
+		return nil
+	}
+	call := l.do(key, false)
+	<-call.done
+	if call.err != nil {
+		return call.err
+	}
+	return NewItem(call.val, 0).Decode(out)
+}
+
+// Refresh loads the value by given key and caches it, waits until it is done
+func (l *Loader) Refresh(key string) error {
+	call := l.do(key, false)
+	<-call.done
+	return call.err
+}
+
+// early reports whether to refresh a fresh item before its deadline by XFetch,
+// it is true if now - delta * beta * log(rand) passes the deadline
+func (l *Loader) early(item *Item) bool {
+	if l.Beta <= 0 || item.Delta <= 0 {
+		return false
+	}
+	deadline := item.SoftExpiration
+	if deadline == 0 {
+		deadline = item.Expiration
+	}
+	if deadline == 0 {
+		return false
+	}
+	gap := float64(item.Delta) * l.Beta * -math.Log(1-rand.Float64())
+	return float64(time.Now().UnixNano())+gap >= float64(deadline)
+}
+
+// do starts a load of key in background, or returns the running one,
+// a panic of Load is returned as the error of the call
+func (l *Loader) do(key string, background bool) *groupCall[interface{}] {
+	var onError func(err error)
+	if l.OnError != nil {
+		onError = func(err error) { l.OnError(key, err) }
+	}
+	return l.calls.do(key, background, func() (interface{}, error) {
+		start := time.Now()
+		val, err := l.Load(key)
+		if err != nil {
+			return nil, err
+		}
+		item := newStaleItem(jitterOf(l.Cacher), val, l.TTL, l.HardTTL)
+		item.Delta = int64(time.Since(start))
+		return val, setItem(l.Cacher, key, item)
+	}, onError)
+}
+
+// SetStale cache value by given key with a soft ttl and a hard ttl second,
+// after the soft ttl GetStale returns the value as stale, after the hard ttl
+// it is a miss. The soft deadline is stored in Item, so it works on any adapter.
+func SetStale(c Cacher, key string, v interface{}, ttl, hardTTL int64) error {
+	return setItem(c, key, newStaleItem(jitterOf(c), v, ttl, hardTTL))
+}
+
+// newStaleItem create a cache item with a soft ttl and a hard ttl second,
+// both taken off by jitter, the soft deadline is not after the hard one
+func newStaleItem(j *Jitter, v interface{}, ttl, hardTTL int64) *Item {
+	item := j.NewItem(v, hardTTL)
+	if ttl > 0 {
+		item.SoftExpiration = time.Now().Add(time.Duration(j.TTL(ttl)) * time.Second).UnixNano()
+		if item.Expiration > 0 && item.SoftExpiration > item.Expiration {
+			item.SoftExpiration = item.Expiration
+		}
+	}
+	return item
+}
+
+// jitterOf returns the jitter of c, nil if c has no jitter
+func jitterOf(c Cacher) *Jitter {
+	if t, ok := c.(interface{ Jitter() *Jitter }); ok {
+		return t.Jitter()
+	}
+	return nil
+}
+
+// setItem cache the encoded item by given key as bytes for the ttl of item,
+// keeps fields of item on any adapter
+func setItem(c Cacher, key string, item *Item) error {
+	b, err := item.Encode()
+	if err != nil {
+		return err
+	}
+	return c.Set(key, []byte(b), item.TTL)
+}
+
+// GetStale returns value to out by given key like Get of cacher,
+// and reports whether the value is stale, a value cached by Set is never stale
+func GetStale(c Cacher, key string, out interface{}) (stale bool, err error) {
+	item, err := getItem(c, key, out)
+	if err != nil {
+		return false, err
+	}
+	return item.Stale(), nil
+}
+
+// getItem returns the item cached by setItem, and decodes its value to out
+func getItem(c Cacher, key string, out interface{}) (*Item, error) {
+	var data []byte
+	if err := c.Get(key, &data); err != nil {
+		return nil, err
+	}
+	item, err := ItemBinary(data).Item()
+	if err != nil {
+		return nil, err
+	}
+	if err = item.Decode(out); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
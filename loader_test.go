@@ -0,0 +1,229 @@
+package cache
+
+import (
+	"encoding/gob"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCacheLoader(t *testing.T) {
+	Convey("cache loader", t, func() {
+		c := New(Options{
+			Name:    "testLoader",
+			Adapter: "memory",
+		})
+		var loads int64
+		version := "v1"
+		var mu sync.Mutex
+		load := func(key string) (interface{}, error) {
+			atomic.AddInt64(&loads, 1)
+			time.Sleep(time.Millisecond * 50)
+			if key == "fail" {
+				return nil, errors.New("load failed")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			return key + ":" + version, nil
+		}
+		l := NewLoader(c, load, 1, 3)
+
+		Convey("load on miss once", func() {
+			var wg sync.WaitGroup
+			values := make([]string, 10)
+			for i := range values {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					l.Get("key", &values[i])
+				}(i)
+			}
+			wg.Wait()
+			for _, v := range values {
+				So(v, ShouldEqual, "key:v1")
+			}
+			So(atomic.LoadInt64(&loads), ShouldEqual, 1)
+
+			var v string
+			So(l.Get("key", &v), ShouldBeNil)
+			So(v, ShouldEqual, "key:v1")
+			So(atomic.LoadInt64(&loads), ShouldEqual, 1)
+
+			err := l.Get("fail", &v)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("stale while revalidate", func() {
+			var v string
+			l.Get("key", &v)
+			mu.Lock()
+			version = "v2"
+			mu.Unlock()
+			time.Sleep(time.Millisecond * 1100)
+
+			stale, err := GetStale(c, "key", &v)
+			So(err, ShouldBeNil)
+			So(stale, ShouldBeTrue)
+
+			// stale value returned at once, refreshed once in background
+			for i := 0; i < 5; i++ {
+				So(l.Get("key", &v), ShouldBeNil)
+				So(v, ShouldEqual, "key:v1")
+			}
+			time.Sleep(time.Millisecond * 100)
+			So(atomic.LoadInt64(&loads), ShouldEqual, 2)
+			So(l.Get("key", &v), ShouldBeNil)
+			So(v, ShouldEqual, "key:v2")
+		})
+
+		Convey("miss after hard ttl", func() {
+			So(SetStale(c, "hard", "old", 1, 1), ShouldBeNil)
+			time.Sleep(time.Millisecond * 1100)
+			var v string
+			So(l.Get("hard", &v), ShouldBeNil)
+			So(v, ShouldEqual, "hard:v1")
+			So(atomic.LoadInt64(&loads), ShouldEqual, 1)
+		})
+
+		Convey("values of set", func() {
+			c.Set("plain", "1", 10)
+			var v string
+			stale, err := GetStale(c, "plain", &v)
+			So(err, ShouldBeNil)
+			So(stale, ShouldBeFalse)
+			So(v, ShouldEqual, "1")
+
+			type s struct {
+				Name string
+			}
+			gob.Register(s{})
+			So(SetStale(c, "struct", s{"test"}, 10, 0), ShouldBeNil)
+			var sv s
+			stale, err = GetStale(c, "struct", &sv)
+			So(err, ShouldBeNil)
+			So(stale, ShouldBeFalse)
+			So(sv.Name, ShouldEqual, "test")
+
+			So(l.Refresh("key"), ShouldBeNil)
+			So(c.Exist("key"), ShouldBeTrue)
+		})
+	})
+}
+
+func TestCacheLoaderError(t *testing.T) {
+	Convey("cache loader error", t, func() {
+		c := New(Options{
+			Name:    "testLoaderError",
+			Adapter: "memory",
+		})
+		var fail int32
+		l := NewLoader(c, func(key string) (interface{}, error) {
+			time.Sleep(time.Millisecond * 50)
+			if key == "panic" {
+				panic("load panic")
+			}
+			if atomic.LoadInt32(&fail) == 1 {
+				return nil, errors.New("load failed")
+			}
+			return key, nil
+		}, 1, 10)
+		errs := make(chan error, 10)
+		l.OnError = func(key string, err error) {
+			errs <- err
+		}
+
+		Convey("panic of load", func() {
+			var wg sync.WaitGroup
+			results := make([]error, 5)
+			for i := range results {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					var v string
+					results[i] = l.Get("panic", &v)
+				}(i)
+			}
+			wg.Wait()
+			for _, err := range results {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "load panic")
+			}
+			// the failed call is dropped, the next get loads again
+			var v string
+			So(l.Get("panic", &v), ShouldNotBeNil)
+			So(l.calls.calls, ShouldBeEmpty)
+			// errors returned to callers are not reported
+			So(len(errs), ShouldEqual, 0)
+		})
+
+		Convey("errors of background refresh", func() {
+			var v string
+			So(l.Get("key", &v), ShouldBeNil)
+			time.Sleep(time.Millisecond * 1100)
+			atomic.StoreInt32(&fail, 1)
+			So(l.Get("key", &v), ShouldBeNil)
+			So(v, ShouldEqual, "key")
+			select {
+			case err := <-errs:
+				So(err.Error(), ShouldEqual, "load failed")
+			case <-time.After(time.Second):
+				So("no error reported", ShouldBeEmpty)
+			}
+		})
+	})
+}
+
+func TestCacheLoaderEarly(t *testing.T) {
+	Convey("cache loader early refresh", t, func() {
+		l := &Loader{Beta: 1}
+		now := time.Now()
+
+		// a slow value near its deadline is refreshed early
+		item := &Item{Delta: int64(1000 * time.Hour), Expiration: now.Add(time.Second).UnixNano()}
+		So(l.early(item), ShouldBeTrue)
+		item.SoftExpiration = now.Add(time.Second).UnixNano()
+		item.Expiration = now.Add(time.Hour).UnixNano()
+		So(l.early(item), ShouldBeTrue)
+
+		// a fast value far from its deadline is not
+		item = &Item{Delta: 1, Expiration: now.Add(time.Hour).UnixNano()}
+		So(l.early(item), ShouldBeFalse)
+
+		// off without beta, delta or deadline
+		item = &Item{Delta: int64(1000 * time.Hour), Expiration: now.Add(time.Second).UnixNano()}
+		So((&Loader{}).early(item), ShouldBeFalse)
+		So(l.early(&Item{Expiration: item.Expiration}), ShouldBeFalse)
+		So(l.early(&Item{Delta: item.Delta}), ShouldBeFalse)
+
+		Convey("refresh before expiry", func() {
+			c := New(Options{
+				Name:    "testLoaderEarly",
+				Adapter: "memory",
+			})
+			var loads int64
+			l := NewLoader(c, func(key string) (interface{}, error) {
+				time.Sleep(time.Millisecond * 50)
+				return atomic.AddInt64(&loads, 1), nil
+			}, 10, 10)
+			l.Beta = 1e6
+
+			var v int64
+			So(l.Get("key", &v), ShouldBeNil)
+			So(v, ShouldEqual, 1)
+
+			item, err := getItem(c, "key", &v)
+			So(err, ShouldBeNil)
+			So(item.Delta, ShouldBeGreaterThanOrEqualTo, int64(50*time.Millisecond))
+
+			// the cached value is returned, and refreshed in background
+			So(l.Get("key", &v), ShouldBeNil)
+			So(v, ShouldEqual, 1)
+			time.Sleep(time.Millisecond * 100)
+			So(atomic.LoadInt64(&loads), ShouldEqual, 2)
+		})
+	})
+}
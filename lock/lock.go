@@ -0,0 +1,240 @@
+// Package lock providers distributed locks built on cacher,
+// for de-duplication of cron jobs and leader election.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	mrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/go-baa/cache"
+)
+
+const (
+	// DefaultBackoff is the default delay before the first retry
+	DefaultBackoff = 50 * time.Millisecond
+	// DefaultMaxBackoff is the default maximum delay of retries
+	DefaultMaxBackoff = time.Second
+)
+
+var (
+	// ErrNotObtained returned by Lock if the lock is held by others after all retries
+	ErrNotObtained = errors.New("lock: not obtained")
+	// ErrNotHeld returned by Unlock and Refresh if the lock has expired or is held by others
+	ErrNotHeld = errors.New("lock: not held")
+)
+
+// Store the atomic operations locks are built on,
+// implemented by adapters memory, redis, memcache and tiered
+type Store interface {
+	// SetNX cache value by given key only if the key does not exist, returns true if cached
+	SetNX(key string, v string, ttl time.Duration) (bool, error)
+	// CompareAndDelete delete cached data by given key only if its value is v, returns true if deleted
+	CompareAndDelete(key string, v string) (bool, error)
+	// CompareAndExpire sets ttl of cached data by given key only if its value is v, returns true if set
+	CompareAndExpire(key string, v string, ttl time.Duration) (bool, error)
+}
+
+// Options locker options
+type Options struct {
+	Retries     int           // retries after the first attempt, negative for retrying until ctx is done
+	Backoff     time.Duration // delay before the first retry, doubled by every retry, default 50ms
+	MaxBackoff  time.Duration // maximum delay of retries, default 1s
+	AutoRefresh time.Duration // interval to refresh a held lock in background, 0 for off
+}
+
+// Locker obtains locks on a cacher
+type Locker struct {
+	store Store
+	opt   Options
+}
+
+// New create a locker on c, returns cache.ErrNotSupported if the adapter cannot support locks
+func New(c cache.Cacher, o Options) (*Locker, error) {
+	store, ok := c.(Store)
+	if !ok {
+		return nil, cache.ErrNotSupported
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = DefaultBackoff
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = DefaultMaxBackoff
+	}
+	return &Locker{store: store, opt: o}, nil
+}
+
+// Lock obtains the lock of given key for ttl, retries with backoff by the options
+// until ctx is done, returns ErrNotObtained if the lock is held by others after all retries
+func (l *Locker) Lock(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	backoff := l.opt.Backoff
+	for i := 0; ; i++ {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		ok, err := l.store.SetNX(key, token, ttl)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return newLock(l, key, token, ttl), nil
+		}
+		if l.opt.Retries >= 0 && i >= l.opt.Retries {
+			return nil, ErrNotObtained
+		}
+
+		// a random delay of backoff/2 to backoff, so waiters do not retry together
+		t := time.NewTimer(backoff/2 + time.Duration(mrand.Int63n(int64(backoff/2)+1)))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+		if backoff *= 2; backoff > l.opt.MaxBackoff {
+			backoff = l.opt.MaxBackoff
+		}
+	}
+}
+
+// Lock a held lock
+type Lock struct {
+	locker   *Locker
+	key      string
+	token    string
+	mu       sync.Mutex
+	ttl      time.Duration
+	lost     chan struct{}
+	lostOnce sync.Once
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// newLock create a held lock, starts auto refresh by the options
+func newLock(l *Locker, key, token string, ttl time.Duration) *Lock {
+	k := &Lock{
+		locker: l,
+		key:    key,
+		token:  token,
+		ttl:    ttl,
+		lost:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if l.opt.AutoRefresh > 0 {
+		go k.autoRefresh(l.opt.AutoRefresh)
+	}
+	return k
+}
+
+// Key returns the key of the lock
+func (k *Lock) Key() string {
+	return k.key
+}
+
+// Token returns the random token identifying the holder of the lock
+func (k *Lock) Token() string {
+	return k.token
+}
+
+// Refresh extends the lock to given ttl from now,
+// returns ErrNotHeld if the lock has expired or is held by others
+func (k *Lock) Refresh(ttl time.Duration) error {
+	err := k.refresh(ttl)
+	if err == ErrNotHeld {
+		k.markLost()
+	}
+	return err
+}
+
+// refresh extends the lock to given ttl from now
+func (k *Lock) refresh(ttl time.Duration) error {
+	ok, err := k.locker.store.CompareAndExpire(k.key, k.token, ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotHeld
+	}
+	k.mu.Lock()
+	k.ttl = ttl
+	k.mu.Unlock()
+	return nil
+}
+
+// Unlock releases the lock and stops auto refresh,
+// returns ErrNotHeld if the lock has expired or is held by others
+func (k *Lock) Unlock() error {
+	k.doneOnce.Do(func() { close(k.done) })
+	ok, err := k.locker.store.CompareAndDelete(k.key, k.token)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		k.markLost()
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// Lost returns a channel closed when the lock is found lost,
+// by Refresh, Unlock or auto refresh
+func (k *Lock) Lost() <-chan struct{} {
+	return k.lost
+}
+
+// markLost closes the lost channel
+func (k *Lock) markLost() {
+	k.lostOnce.Do(func() { close(k.lost) })
+}
+
+// autoRefresh refreshes the lock with its ttl every interval until unlocked or lost,
+// the lock is taken as lost if refresh fails for a ttl
+func (k *Lock) autoRefresh(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-k.done:
+			return
+		case <-k.lost:
+			return
+		case <-t.C:
+		}
+		k.mu.Lock()
+		ttl := k.ttl
+		k.mu.Unlock()
+		err := k.refresh(ttl)
+		if err == nil {
+			last = time.Now()
+			continue
+		}
+		select {
+		case <-k.done:
+			// unlocked during the refresh
+			return
+		default:
+		}
+		if err == ErrNotHeld || time.Since(last) >= ttl {
+			k.markLost()
+			return
+		}
+	}
+}
+
+// newToken returns a random token of lock holder
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
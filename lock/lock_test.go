@@ -0,0 +1,122 @@
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-baa/cache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLock(t *testing.T) {
+	Convey("lock", t, func() {
+		c := cache.New(cache.Options{
+			Name:    "testLock",
+			Adapter: "memory",
+		})
+		ctx := context.Background()
+		l, err := New(c, Options{})
+		So(err, ShouldBeNil)
+
+		Convey("lock and unlock", func() {
+			k, err := l.Lock(ctx, "job", time.Second)
+			So(err, ShouldBeNil)
+			So(k.Key(), ShouldEqual, "job")
+			So(k.Token(), ShouldNotBeEmpty)
+
+			_, err = l.Lock(ctx, "job", time.Second)
+			So(err, ShouldEqual, ErrNotObtained)
+
+			So(k.Unlock(), ShouldBeNil)
+			k2, err := l.Lock(ctx, "job", time.Second)
+			So(err, ShouldBeNil)
+			So(k2.Token(), ShouldNotEqual, k.Token())
+
+			// unlock a lock held by others
+			So(k.Unlock(), ShouldEqual, ErrNotHeld)
+			So(isClosed(k.Lost()), ShouldBeTrue)
+			So(isClosed(k2.Lost()), ShouldBeFalse)
+			So(k2.Unlock(), ShouldBeNil)
+		})
+
+		Convey("retry", func() {
+			k, _ := l.Lock(ctx, "retry", time.Second)
+			go func() {
+				time.Sleep(time.Millisecond * 100)
+				k.Unlock()
+			}()
+			retry, _ := New(c, Options{Retries: -1, Backoff: time.Millisecond * 10})
+			k2, err := retry.Lock(ctx, "retry", time.Second)
+			So(err, ShouldBeNil)
+
+			timeout, cancel := context.WithTimeout(ctx, time.Millisecond*100)
+			defer cancel()
+			_, err = retry.Lock(timeout, "retry", time.Second)
+			So(err, ShouldResemble, context.DeadlineExceeded)
+
+			limited, _ := New(c, Options{Retries: 2, Backoff: time.Millisecond * 10})
+			start := time.Now()
+			_, err = limited.Lock(ctx, "retry", time.Second)
+			So(err, ShouldEqual, ErrNotObtained)
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, time.Millisecond*15)
+			k2.Unlock()
+		})
+
+		Convey("expire and refresh", func() {
+			k, _ := l.Lock(ctx, "refresh", time.Millisecond*100)
+			So(k.Refresh(time.Second), ShouldBeNil)
+			time.Sleep(time.Millisecond * 150)
+			_, err := l.Lock(ctx, "refresh", time.Second)
+			So(err, ShouldEqual, ErrNotObtained)
+
+			So(k.Refresh(time.Millisecond*50), ShouldBeNil)
+			time.Sleep(time.Millisecond * 100)
+			So(k.Refresh(time.Second), ShouldEqual, ErrNotHeld)
+			So(isClosed(k.Lost()), ShouldBeTrue)
+		})
+
+		Convey("auto refresh", func() {
+			auto, _ := New(c, Options{AutoRefresh: time.Millisecond * 30})
+			k, _ := auto.Lock(ctx, "auto", time.Millisecond*100)
+			time.Sleep(time.Millisecond * 300)
+			_, err := l.Lock(ctx, "auto", time.Second)
+			So(err, ShouldEqual, ErrNotObtained)
+			So(k.Unlock(), ShouldBeNil)
+			So(isClosed(k.Lost()), ShouldBeFalse)
+
+			// lost notification
+			k, _ = auto.Lock(ctx, "auto", time.Millisecond*100)
+			c.Delete("auto")
+			select {
+			case <-k.Lost():
+			case <-time.After(time.Second):
+			}
+			So(isClosed(k.Lost()), ShouldBeTrue)
+		})
+
+		Convey("namespace", func() {
+			jobs, err := New(c.Namespace("jobs"), Options{})
+			So(err, ShouldBeNil)
+			k, err := jobs.Lock(ctx, "job", time.Second)
+			So(err, ShouldBeNil)
+			So(c.Exist("jobs:job"), ShouldBeTrue)
+			So(k.Unlock(), ShouldBeNil)
+		})
+
+		Convey("not supported", func() {
+			_, err := New(struct{ cache.Cacher }{c}, Options{})
+			So(err, ShouldEqual, cache.ErrNotSupported)
+		})
+	})
+}
+
+// isClosed returns true if ch is closed
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
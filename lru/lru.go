@@ -149,6 +149,18 @@ func (c *Cache) Len() int {
 	return c.ll.Len()
 }
 
+// Keys returns the keys of the cache, from the newest to the oldest.
+func (c *Cache) Keys() []Key {
+	if c.cache == nil {
+		return nil
+	}
+	keys := make([]Key, 0, c.ll.Len())
+	for e := c.ll.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(*entry).key)
+	}
+	return keys
+}
+
 // Clear purges all stored items from the cache.
 func (c *Cache) Clear() {
 	c.mutex.Lock()
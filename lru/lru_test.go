@@ -95,3 +95,21 @@ func TestEvict(t *testing.T) {
 		t.Fatalf("got %v in second evicted key; want %s", evictedKeys[1], "myKey1")
 	}
 }
+
+func TestKeys(t *testing.T) {
+	lru := New(0)
+	if keys := lru.Keys(); len(keys) != 0 {
+		t.Fatalf("got %d keys on empty cache; want 0", len(keys))
+	}
+	lru.Add("myKey0", 1234)
+	lru.Add("myKey1", 1234)
+	lru.Get("myKey0")
+
+	keys := lru.Keys()
+	if len(keys) != 2 {
+		t.Fatalf("got %d keys; want 2", len(keys))
+	}
+	if keys[0] != Key("myKey0") || keys[1] != Key("myKey1") {
+		t.Fatalf("got keys %v; want [myKey0 myKey1]", keys)
+	}
+}
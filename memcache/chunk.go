@@ -0,0 +1,120 @@
+package memcache
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// DefaultChunkSize is the default maximum bytes of a stored value,
+// the default item size limit of memcached is 1mb including the key and item header
+const DefaultChunkSize = 1<<20 - 1024
+
+// manifestHeader is the header of a manifest value, which lists the chunks
+// of an oversized value. Like the wire format of package cache, it starts
+// with the marker byte 0xff and the magic byte 'c'.
+const manifestHeader = "\xffcm"
+
+// manifest describes the chunks of an oversized value
+type manifest struct {
+	id     string // random id of the chunks of a value
+	chunks int    // number of chunks
+	size   int    // total bytes of the value
+}
+
+// chunkKey returns the key of the chunk i of the value stored by key
+func (m *manifest) chunkKey(key string, i int) string {
+	return normalizeKey(key + ":__chunk:" + m.id + ":" + strconv.Itoa(i))
+}
+
+// encode returns the manifest value
+func (m *manifest) encode() []byte {
+	return []byte(manifestHeader + m.id + ":" + strconv.Itoa(m.chunks) + ":" + strconv.Itoa(m.size))
+}
+
+// parseManifest parses manifest value, returns nil if data is not a manifest
+func parseManifest(data []byte) *manifest {
+	if !bytes.HasPrefix(data, []byte(manifestHeader)) {
+		return nil
+	}
+	fields := strings.Split(string(data[len(manifestHeader):]), ":")
+	if len(fields) != 3 {
+		return nil
+	}
+	chunks, err := strconv.Atoi(fields[1])
+	if err != nil || chunks <= 0 {
+		return nil
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil || size < 0 {
+		return nil
+	}
+	return &manifest{id: fields[0], chunks: chunks, size: size}
+}
+
+// set stores value by the storage key, a value larger than chunk size is split into
+// chunks, the chunks are stored before a manifest by the key, every write uses new
+// chunk keys, so a reader never mixes chunks of different values.
+// Chunks of an overwritten or deleted value are left to be evicted by memcached.
+func (c *Memcache) set(key string, value []byte, ttl int64) error {
+	if len(value) <= c.chunkSize {
+		return c.handle.Set(&memcache.Item{Key: key, Value: value, Expiration: int32(ttl), Flags: deadline(int32(ttl))})
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	m := &manifest{
+		id:     hex.EncodeToString(id),
+		chunks: (len(value) + c.chunkSize - 1) / c.chunkSize,
+		size:   len(value),
+	}
+	for i := 0; i < m.chunks; i++ {
+		end := (i + 1) * c.chunkSize
+		if end > len(value) {
+			end = len(value)
+		}
+		err := c.handle.Set(&memcache.Item{Key: m.chunkKey(key, i), Value: value[i*c.chunkSize : end], Expiration: int32(ttl)})
+		if err != nil {
+			return err
+		}
+	}
+	return c.handle.Set(&memcache.Item{Key: key, Value: m.encode(), Expiration: int32(ttl), Flags: deadline(int32(ttl))})
+}
+
+// load returns value by the storage key, the chunks of an oversized value are
+// reassembled, a missing chunk is a cache miss
+func (c *Memcache) load(key string) ([]byte, error) {
+	v, err := c.handle.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	m := parseManifest(v.Value)
+	if m == nil {
+		return v.Value, nil
+	}
+	keys := make([]string, m.chunks)
+	for i := range keys {
+		keys[i] = m.chunkKey(key, i)
+	}
+	chunks, err := c.handle.GetMulti(keys)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, 0, m.size)
+	for _, k := range keys {
+		chunk, ok := chunks[k]
+		if !ok {
+			return nil, memcache.ErrCacheMiss
+		}
+		value = append(value, chunk.Value...)
+	}
+	if len(value) != m.size {
+		return nil, memcache.ErrCacheMiss
+	}
+	return value, nil
+}
@@ -0,0 +1,65 @@
+package memcache
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/go-baa/cache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemcacheChunk(t *testing.T) {
+	Convey("memcache large value chunks", t, func() {
+		c, err := cache.NewCacher("memcache", cache.Options{
+			Name:   "testChunk",
+			Prefix: "chunk:",
+			Config: map[string]interface{}{
+				"chunkSize": 1024,
+			},
+		})
+		So(err, ShouldBeNil)
+		m := c.(*Memcache)
+
+		Convey("manifest", func() {
+			mf := &manifest{id: "abc", chunks: 3, size: 2100}
+			So(parseManifest(mf.encode()), ShouldResemble, mf)
+			So(parseManifest([]byte("abc")), ShouldBeNil)
+			So(parseManifest([]byte(manifestHeader+"abc:x:1")), ShouldBeNil)
+		})
+
+		Convey("set and get", func() {
+			v := strings.Repeat("0123456789", 300)
+			err := c.Set("large", v, 10)
+			So(err, ShouldBeNil)
+			var v1 string
+			err = c.Get("large", &v1)
+			So(err, ShouldBeNil)
+			So(v1, ShouldEqual, v)
+
+			b := bytes.Repeat([]byte{0xff, 0}, 1024)
+			err = c.SetWithTags("bytes", b, 10, "chunk")
+			So(err, ShouldBeNil)
+			var b1 []byte
+			err = c.Get("bytes", &b1)
+			So(err, ShouldBeNil)
+			So(b1, ShouldResemble, b)
+			So(c.InvalidateTags("chunk"), ShouldBeNil)
+			So(c.Exist("bytes"), ShouldBeFalse)
+		})
+
+		Convey("missing chunk is a miss", func() {
+			err := c.Set("large", strings.Repeat("a", 3000), 10)
+			So(err, ShouldBeNil)
+			k, err := m.key("large")
+			So(err, ShouldBeNil)
+			v, err := m.handle.Get(k)
+			So(err, ShouldBeNil)
+			mf := parseManifest(v.Value)
+			So(mf, ShouldNotBeNil)
+			So(mf.chunks, ShouldEqual, 3)
+			So(m.handle.Delete(mf.chunkKey(k, 1)), ShouldBeNil)
+			So(c.Exist("large"), ShouldBeFalse)
+		})
+	})
+}
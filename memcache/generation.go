@@ -0,0 +1,75 @@
+package memcache
+
+import (
+	"sync"
+	"time"
+)
+
+// generations caches the generations of a cacher and its namespaces in process,
+// so an operation reads the generation key at most once per refresh interval.
+// A flush in process is seen at once, a flush of other processes is seen
+// after at most the refresh interval.
+type generations struct {
+	mu      sync.Mutex
+	refresh time.Duration
+	m       map[string]generation // by cache prefix
+}
+
+// generation a cached generation of a namespace
+type generation struct {
+	base    string // key prefix before generation, it changes with the generation of parent
+	prefix  string // key prefix of the generation
+	expires time.Time
+}
+
+// newGenerations create a generation cache, refresh 0 disables it
+func newGenerations(refresh time.Duration) *generations {
+	return &generations{
+		refresh: refresh,
+		m:       make(map[string]generation),
+	}
+}
+
+// get returns the cached key prefix of the cacher under given base
+func (g *generations) get(name, base string) (string, bool) {
+	if g == nil || g.refresh <= 0 {
+		return "", false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	gen, ok := g.m[name]
+	if !ok || gen.base != base || time.Now().After(gen.expires) {
+		return "", false
+	}
+	return gen.prefix, true
+}
+
+// set caches the key prefix of the cacher under given base
+func (g *generations) set(name, base, prefix string) {
+	if g == nil || g.refresh <= 0 {
+		return
+	}
+	g.mu.Lock()
+	g.m[name] = generation{base: base, prefix: prefix, expires: time.Now().Add(g.refresh)}
+	g.mu.Unlock()
+}
+
+// reset drops all cached generations
+func (g *generations) reset() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	g.m = make(map[string]generation)
+	g.mu.Unlock()
+}
+
+// forget drops the cached generation of the cacher
+func (g *generations) forget(name string) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	delete(g.m, name)
+	g.mu.Unlock()
+}
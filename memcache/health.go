@@ -0,0 +1,60 @@
+package memcache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// ping checks the memcached server of given address by the version command,
+// it has no side effect on cached data
+func ping(addr net.Addr, timeout time.Duration) error {
+	conn, err := net.DialTimeout(addr.Network(), addr.String(), timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err = io.WriteString(conn, "version\r\n"); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "VERSION ") {
+		return fmt.Errorf("memcache: unexpected response of version %q", strings.TrimSpace(line))
+	}
+	return nil
+}
+
+// check pings all servers, marks servers down or up by the result,
+// returns the number of live servers
+func (s *Selector) check(timeout time.Duration) int {
+	var live int
+	for _, addr := range s.servers() {
+		err := ping(addr, timeout)
+		s.mark(addr, err != nil)
+		if err == nil {
+			live++
+		}
+	}
+	return live
+}
+
+// monitor checks servers every interval until stop is closed
+func (s *Selector) monitor(interval, timeout time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.check(timeout)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package memcache
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-baa/cache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemcacheHealth(t *testing.T) {
+	Convey("memcache health check", t, func() {
+		// a closed listener gives an address of down server
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		downAddr := l.Addr().String()
+		l.Close()
+
+		Convey("start without side effect", func() {
+			c, err := cache.NewCacher("memcache", cache.Options{
+				Name:   "testHealth",
+				Prefix: "health:",
+				Config: map[string]interface{}{
+					"timeout":      "200ms",
+					"maxIdleConns": 4,
+				},
+			})
+			So(err, ShouldBeNil)
+			So(c.Exist("foo"), ShouldBeFalse)
+			m := c.(*Memcache)
+			So(m.handle.Timeout, ShouldEqual, 200*time.Millisecond)
+			So(m.handle.MaxIdleConns, ShouldEqual, 4)
+			So(m.Close(), ShouldBeNil)
+		})
+
+		Convey("down server fails start", func() {
+			_, err := cache.NewCacher("memcache", cache.Options{
+				Name: "testHealth",
+				Config: map[string]interface{}{
+					"servers": []string{"127.0.0.1:11211", downAddr},
+					"timeout": "200ms",
+				},
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("monitor marks down servers", func() {
+			c, err := cache.NewCacher("memcache", cache.Options{
+				Name: "testHealth",
+				Config: map[string]interface{}{
+					"servers":     []string{"127.0.0.1:11211", downAddr},
+					"timeout":     "200ms",
+					"healthCheck": "100ms",
+				},
+			})
+			So(err, ShouldBeNil)
+			m := c.(*Memcache)
+			So(m.selector.Down(), ShouldResemble, []string{downAddr})
+			for i := 0; i < 20; i++ {
+				err = c.Set("key"+string(rune('a'+i)), i, 10)
+				So(err, ShouldBeNil)
+			}
+
+			// the server is up again
+			l, err := net.Listen("tcp", downAddr)
+			So(err, ShouldBeNil)
+			defer l.Close()
+			go func() {
+				for {
+					conn, err := l.Accept()
+					if err != nil {
+						return
+					}
+					buf := make([]byte, 64)
+					conn.Read(buf)
+					conn.Write([]byte("VERSION 1.6.0\r\n"))
+					conn.Close()
+				}
+			}()
+			time.Sleep(300 * time.Millisecond)
+			So(m.selector.Down(), ShouldBeEmpty)
+			So(m.Close(), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,37 @@
+package memcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// maxKeyLength is the maximum key length of memcached
+const maxKeyLength = 250
+
+// hashedKeyPrefix is the prefix of hashed keys. A key starting with it
+// is hashed too, so a hashed key never collides with another key.
+const hashedKeyPrefix = "__sha256:"
+
+// normalizeKey returns a key accepted by memcached, a key too long or
+// containing spaces or control characters is replaced by its sha256 hash
+func normalizeKey(key string) string {
+	if legalKey(key) && !strings.HasPrefix(key, hashedKeyPrefix) {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hashedKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+// legalKey check key is accepted by memcached
+func legalKey(key string) bool {
+	if len(key) > maxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
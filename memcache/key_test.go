@@ -0,0 +1,47 @@
+package memcache
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemcacheKey(t *testing.T) {
+	Convey("memcache key normalization", t, func() {
+		Convey("normalize key", func() {
+			So(normalizeKey("user:1"), ShouldEqual, "user:1")
+			So(normalizeKey("用户:1"), ShouldEqual, "用户:1")
+			long := strings.Repeat("a", 300)
+			So(len(normalizeKey(long)), ShouldBeLessThanOrEqualTo, maxKeyLength)
+			So(normalizeKey(long), ShouldNotEqual, normalizeKey(long+"b"))
+			So(normalizeKey("a b"), ShouldStartWith, hashedKeyPrefix)
+			So(normalizeKey("a\nb"), ShouldStartWith, hashedKeyPrefix)
+			hashed := normalizeKey("a b")
+			So(normalizeKey(hashed), ShouldNotEqual, hashed)
+		})
+
+		Convey("illegal keys work like other adapters", func() {
+			keys := []string{
+				"https://example.com/search?q=go baa",
+				strings.Repeat("long", 100),
+				"tab\tkey",
+				normalizeKey("a b"),
+			}
+			for i, key := range keys {
+				err := c.Set(key, i, 10)
+				So(err, ShouldBeNil)
+				var v int
+				err = c.Get(key, &v)
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, i)
+				n, err := c.Incr(key)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, i+1)
+				So(c.Delete(key), ShouldBeNil)
+				So(c.Exist(key), ShouldBeFalse)
+			}
+			So(c.Exist("a b"), ShouldBeFalse)
+		})
+	})
+}
@@ -2,16 +2,38 @@ package memcache
 
 import (
 	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/bradfitz/gomemcache/memcache"
 	"github.com/go-baa/cache"
 )
 
+// generationKey is the key, after cache prefix, storing the generation
+// of the cache namespace. Every cached key is prefixed by the current
+// generation, so increasing it invalidates all keys of the namespace.
+const generationKey = "__generation"
+
+// tagKeyPrefix is the key prefix, after generation, of tag versions
+const tagKeyPrefix = "__tag:"
+
+// updateRetries is the attempts of Update before it gives up on cas conflicts
+const updateRetries = 10
+
 // Memcache implement a memcache cache adapter for cacher
 type Memcache struct {
-	Name   string
-	Prefix string
-	handle *memcache.Client
+	Name      string
+	Prefix    string
+	handle    *memcache.Client
+	selector  *Selector     // servers of the client
+	chunkSize int           // maximum bytes of a stored value, larger values are chunked
+	stop      chan struct{} // closed to stop the health monitor
+	parent    *Memcache     // parent cacher of a namespace
+	namespace string        // namespace key prefix under parent
+	jitter    *cache.Jitter // jitter of ttl, nil if not set
+	gens      *generations  // generations cached in process, shared with namespaces
 }
 
 // New create a cache instance of memcache
@@ -21,7 +43,7 @@ func New() cache.Cacher {
 
 // Exist return true if value cached by given key
 func (c *Memcache) Exist(key string) bool {
-	_, err := c.handle.Get(c.Prefix + key)
+	_, err := c.get(key)
 	if err == nil {
 		return true
 	}
@@ -30,102 +52,629 @@ func (c *Memcache) Exist(key string) bool {
 
 // Get returns value by given key
 func (c *Memcache) Get(key string, out interface{}) error {
-	v, err := c.handle.Get(c.Prefix + key)
+	item, err := c.get(key)
+	if err == memcache.ErrCacheMiss {
+		return cache.MissError(err)
+	}
 	if err != nil {
 		return err
 	}
+	return item.Decode(out)
+}
 
-	if cache.SimpleValue(v.Value, out) {
-		return nil
+// GetWithTags returns value by given key like Get, and the tags associated with it
+func (c *Memcache) GetWithTags(key string, out interface{}) ([]string, error) {
+	item, err := c.get(key)
+	if err == memcache.ErrCacheMiss {
+		return nil, cache.MissError(err)
 	}
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for tag := range item.Tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags, item.Decode(out)
+}
 
-	item, err := cache.ItemBinary(v.Value).Item()
+// get returns the decoded item by given key,
+// data associated with invalidated tags is treated as cache miss
+func (c *Memcache) get(key string) (*cache.Item, error) {
+	k, err := c.key(key)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return item.Decode(out)
+	v, err := c.load(k)
+	if err != nil {
+		return nil, err
+	}
+	item, err := cache.ItemBinary(v).Item()
+	if err != nil {
+		return nil, err
+	}
+	if len(item.Tags) > 0 {
+		valid, err := c.validTags(item.Tags)
+		if err != nil {
+			return nil, err
+		}
+		if !valid {
+			return nil, memcache.ErrCacheMiss
+		}
+	}
+	return item, nil
 }
 
 // Set cache value by given key, cache ttl second
 func (c *Memcache) Set(key string, v interface{}, ttl int64) error {
-	var t []byte
-	if !cache.SimpleType(v) {
-		item := cache.NewItem(v, ttl)
-		b, err := item.Encode()
+	k, err := c.key(key)
+	if err != nil {
+		return err
+	}
+	ttl = c.jitter.TTL(ttl)
+	b, err := cache.NewItem(v, ttl).Encode()
+	if err != nil {
+		return err
+	}
+	return c.set(k, b, ttl)
+}
+
+// SetWithTags cache value by given key like Set, and associates it with given tags,
+// the current tag versions are stored with value, a value is valid only if
+// all its tag versions are not changed
+func (c *Memcache) SetWithTags(key string, v interface{}, ttl int64, tags ...string) error {
+	if len(tags) == 0 {
+		return c.Set(key, v, ttl)
+	}
+	k, err := c.key(key)
+	if err != nil {
+		return err
+	}
+	ttl = c.jitter.TTL(ttl)
+	item := cache.NewItem(v, ttl)
+	item.Tags, err = c.tagVersions(tags)
+	if err != nil {
+		return err
+	}
+	b, err := item.Encode()
+	if err != nil {
+		return err
+	}
+	return c.set(k, b, ttl)
+}
+
+// InvalidateTags delete all cached data associated with given tags,
+// it increases the tag versions
+func (c *Memcache) InvalidateTags(tags ...string) error {
+	for _, tag := range tags {
+		k, err := c.key(tagKeyPrefix + tag)
 		if err != nil {
 			return err
 		}
-		t = []byte(b)
-	} else {
-		t = []byte(fmt.Sprintf("%v", v))
+		_, err = c.handle.Increment(k, 1)
+		if err != nil && err != memcache.ErrCacheMiss {
+			return err
+		}
 	}
-	return c.handle.Set(&memcache.Item{Key: c.Prefix + key, Value: t, Expiration: int32(ttl)})
+	return nil
 }
 
-// Incr increases cached int-type value by given key as a counter
-// if key not exist, before increase set value with zero
-func (c *Memcache) Incr(key string) (int64, error) {
-	v, err := c.handle.Increment(c.Prefix+key, 1)
-	if err != nil {
+// tagVersions returns current versions of given tags,
+// creates versions for new tags
+func (c *Memcache) tagVersions(tags []string) (map[string]int64, error) {
+	versions := make(map[string]int64, len(tags))
+	for _, tag := range tags {
+		k, err := c.key(tagKeyPrefix + tag)
+		if err != nil {
+			return nil, err
+		}
+		v, err := c.handle.Get(k)
 		if err == memcache.ErrCacheMiss {
-			err = c.Set(key, 0, 0)
+			// start from current time like generation, never goes back
+			ver := strconv.FormatInt(time.Now().UnixNano(), 10)
+			err = c.handle.Add(&memcache.Item{Key: k, Value: []byte(ver)})
 			if err == nil {
-				return c.Incr(key)
+				v = &memcache.Item{Value: []byte(ver)}
+			} else if err == memcache.ErrNotStored {
+				v, err = c.handle.Get(k)
 			}
 		}
+		if err != nil {
+			return nil, err
+		}
+		versions[tag], err = strconv.ParseInt(string(v.Value), 10, 64)
+		if err != nil {
+			return nil, err
+		}
 	}
-	return int64(v), err
+	return versions, nil
+}
+
+// validTags returns true if all given tag versions are current versions
+func (c *Memcache) validTags(versions map[string]int64) (bool, error) {
+	keys := make(map[string]string, len(versions))
+	ks := make([]string, 0, len(versions))
+	for tag := range versions {
+		k, err := c.key(tagKeyPrefix + tag)
+		if err != nil {
+			return false, err
+		}
+		keys[tag] = k
+		ks = append(ks, k)
+	}
+	items, err := c.handle.GetMulti(ks)
+	if err != nil {
+		return false, err
+	}
+	for tag, ver := range versions {
+		v, ok := items[keys[tag]]
+		if !ok || string(v.Value) != strconv.FormatInt(ver, 10) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Incr increases cached int-type value by given key as a counter
+// if key not exist, before increase set value with zero
+func (c *Memcache) Incr(key string) (int64, error) {
+	return c.IncrWithTTL(key, 1, 0)
 }
 
 // Decr decreases cached int-type value by given key as a counter
-// if key not exist, return errors
+// if key not exist, before decrease set value with zero
 func (c *Memcache) Decr(key string) (int64, error) {
-	v, err := c.handle.Decrement(c.Prefix+key, 1)
+	return c.IncrWithTTL(key, -1, 0)
+}
+
+// IncrBy increases cached int-type value by given key with delta atomically,
+// if key not exist, before increase set value with zero
+func (c *Memcache) IncrBy(key string, delta int64) (int64, error) {
+	return c.IncrWithTTL(key, delta, 0)
+}
+
+// IncrByFloat increases cached numeric value by given key with float delta,
+// the value is updated by compare-and-swap, retries on conflict.
+// memcached cannot report the remaining ttl of a value, the deadline stored
+// in the item flags by the writes of this adapter is applied again.
+func (c *Memcache) IncrByFloat(key string, delta float64) (float64, error) {
+	k, err := c.key(key)
 	if err != nil {
+		return 0, err
+	}
+	for {
+		item, err := c.handle.Get(k)
 		if err == memcache.ErrCacheMiss {
-			err = c.Set(key, 0, 0)
-			if err == nil {
-				return c.Decr(key)
+			err = c.handle.Add(&memcache.Item{Key: k, Value: []byte(strconv.FormatFloat(delta, 'f', -1, 64))})
+			if err == memcache.ErrNotStored {
+				continue
 			}
+			return delta, err
+		}
+		if err != nil {
+			return 0, err
+		}
+		v, err := strconv.ParseFloat(string(item.Value), 64)
+		if err != nil {
+			return 0, fmt.Errorf("cache: value is not numeric")
+		}
+		v += delta
+		item.Value = []byte(strconv.FormatFloat(v, 'f', -1, 64))
+		// an expiration over 30 days is an absolute unix time for memcached
+		item.Expiration = int32(item.Flags)
+		err = c.handle.CompareAndSwap(item)
+		if err == memcache.ErrCASConflict || err == memcache.ErrNotStored {
+			continue
 		}
+		return v, err
 	}
-	return int64(v), err
+}
+
+// IncrWithTTL increases cached int-type value by given key with delta atomically,
+// if key not exist, the counter is added with ttl second before increase.
+// NOTE: memcached counters cannot be less than zero
+func (c *Memcache) IncrWithTTL(key string, delta int64, ttl int64) (int64, error) {
+	k, err := c.key(key)
+	if err != nil {
+		return 0, err
+	}
+	ttl = c.jitter.TTL(ttl)
+	for {
+		var v uint64
+		if delta >= 0 {
+			v, err = c.handle.Increment(k, uint64(delta))
+		} else {
+			v, err = c.handle.Decrement(k, uint64(-delta))
+		}
+		if err != memcache.ErrCacheMiss {
+			return int64(v), err
+		}
+		// another client may add the counter first, increase it anyway
+		err = c.handle.Add(&memcache.Item{Key: k, Value: []byte("0"), Expiration: int32(ttl), Flags: deadline(int32(ttl))})
+		if err != nil && err != memcache.ErrNotStored {
+			return 0, err
+		}
+	}
+}
+
+// SetNX cache value by given key only if the key does not exist by add,
+// returns true if cached, the ttl is rounded up to seconds
+func (c *Memcache) SetNX(key string, v string, ttl time.Duration) (bool, error) {
+	k, err := c.key(key)
+	if err != nil {
+		return false, err
+	}
+	b, err := cache.NewItem(v, 0).Encode()
+	if err != nil {
+		return false, err
+	}
+	expiration := seconds(c.jitter.Duration(ttl))
+	err = c.handle.Add(&memcache.Item{Key: k, Value: b, Expiration: expiration, Flags: deadline(expiration)})
+	if err == memcache.ErrNotStored {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CompareAndDelete delete cached data by given key only if its value is v,
+// returns true if deleted, the value is expired by cas
+func (c *Memcache) CompareAndDelete(key string, v string) (bool, error) {
+	return c.compareAndSwap(key, v, -1)
+}
+
+// CompareAndExpire sets ttl of cached data by given key only if its value is v,
+// returns true if set, the ttl is rounded up to seconds
+func (c *Memcache) CompareAndExpire(key string, v string, ttl time.Duration) (bool, error) {
+	return c.compareAndSwap(key, v, seconds(ttl))
+}
+
+// compareAndSwap stores the value by given key again with expiration
+// only if it is v by cas, a negative expiration expires it at once
+func (c *Memcache) compareAndSwap(key string, v string, expiration int32) (bool, error) {
+	k, err := c.key(key)
+	if err != nil {
+		return false, err
+	}
+	b, err := cache.NewItem(v, 0).Encode()
+	if err != nil {
+		return false, err
+	}
+	item, err := c.handle.Get(k)
+	if err == memcache.ErrCacheMiss {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if string(item.Value) != string(b) {
+		return false, nil
+	}
+	item.Expiration = expiration
+	item.Flags = deadline(expiration)
+	err = c.handle.CompareAndSwap(item)
+	if err == memcache.ErrCASConflict || err == memcache.ErrNotStored {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Update replaces cached data by given key with the value returned by fn by cas,
+// fn gets nil if the key does not exist. It is best effort: the ttl is rounded up
+// to seconds, fn is called again on conflicts, and memcache.ErrCASConflict
+// is returned if the key keeps changing.
+func (c *Memcache) Update(key string, fn func(old []byte) ([]byte, time.Duration, error)) error {
+	k, err := c.key(key)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < updateRetries; i++ {
+		var old []byte
+		item, err := c.handle.Get(k)
+		if err != nil && err != memcache.ErrCacheMiss {
+			return err
+		}
+		if item != nil {
+			v, err := cache.ItemBinary(item.Value).Item()
+			if err != nil {
+				return err
+			}
+			if err = v.Decode(&old); err != nil {
+				return err
+			}
+		}
+		v, ttl, err := fn(old)
+		if err != nil {
+			return err
+		}
+		b, err := cache.NewItem(v, 0).Encode()
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			err = c.handle.Add(&memcache.Item{Key: k, Value: b, Expiration: seconds(ttl), Flags: deadline(seconds(ttl))})
+		} else {
+			item.Value = b
+			item.Expiration = seconds(ttl)
+			item.Flags = deadline(item.Expiration)
+			err = c.handle.CompareAndSwap(item)
+		}
+		if err != memcache.ErrNotStored && err != memcache.ErrCASConflict {
+			return err
+		}
+	}
+	return memcache.ErrCASConflict
+}
+
+// seconds returns the expiration seconds of ttl rounded up, 0 never expire
+func seconds(ttl time.Duration) int32 {
+	if ttl <= 0 {
+		return 0
+	}
+	return int32((ttl + time.Second - 1) / time.Second)
+}
+
+// maxRelativeExpiration is the longest expiration memcached takes as seconds
+// from now, a larger expiration is an absolute unix time
+const maxRelativeExpiration = 60 * 60 * 24 * 30
+
+// deadline returns the absolute unix time of an expiration, stored in the
+// item flags, so writes which cannot know the ttl, like IncrByFloat, keep it.
+// It is 0 if the item never expires.
+func deadline(expiration int32) uint32 {
+	if expiration <= 0 {
+		return 0
+	}
+	if expiration > maxRelativeExpiration {
+		return uint32(expiration)
+	}
+	return uint32(time.Now().Unix() + int64(expiration))
 }
 
 // Delete delete cached data by given key
 func (c *Memcache) Delete(key string) error {
-	return c.handle.Delete(c.Prefix + key)
+	k, err := c.key(key)
+	if err != nil {
+		return err
+	}
+	return c.handle.Delete(k)
 }
 
-// Flush flush cacher
+// Flush delete all cached data under the cache prefix,
+// it increases the namespace generation, old keys will be evicted by memcached.
+// Other processes see the flush after at most the generation refresh interval.
 func (c *Memcache) Flush() error {
+	base, err := c.base()
+	if err != nil {
+		return err
+	}
+	gen, err := c.handle.Increment(normalizeKey(base+generationKey), 1)
+	if err == memcache.ErrCacheMiss {
+		// generation lost, old keys are unreachable already
+		c.gens.forget(c.Prefix)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.gens.set(c.Prefix, base, base+strconv.FormatUint(gen, 10)+":")
+	return nil
+}
+
+// FlushAll delete all data of the memcached servers
+func (c *Memcache) FlushAll() error {
+	c.gens.reset()
 	return c.handle.FlushAll()
 }
 
+// key returns the storage key of given key in current generation,
+// the key is hashed if memcached cannot accept it
+func (c *Memcache) key(key string) (string, error) {
+	prefix, err := c.prefix()
+	if err != nil {
+		return "", err
+	}
+	return normalizeKey(prefix + key), nil
+}
+
+// base returns the key prefix before generation,
+// a namespace is under the current generation of its parent
+func (c *Memcache) base() (string, error) {
+	if c.parent == nil {
+		return c.Prefix, nil
+	}
+	return c.parent.key(c.namespace)
+}
+
+// prefix returns the key prefix of current generation,
+// the generation is cached in process for the refresh interval
+func (c *Memcache) prefix() (string, error) {
+	base, err := c.base()
+	if err != nil {
+		return "", err
+	}
+	if prefix, ok := c.gens.get(c.Prefix, base); ok {
+		return prefix, nil
+	}
+	prefix, err := c.generation(base)
+	if err != nil {
+		return "", err
+	}
+	c.gens.set(c.Prefix, base, prefix)
+	return prefix, nil
+}
+
+// generation reads the generation under given base from memcached,
+// returns the key prefix of it
+func (c *Memcache) generation(base string) (string, error) {
+	gk := normalizeKey(base + generationKey)
+	v, err := c.handle.Get(gk)
+	if err == nil {
+		return base + string(v.Value) + ":", nil
+	}
+	if err != memcache.ErrCacheMiss {
+		return "", err
+	}
+	// the generation starts from current time, so it never goes back
+	// to an old generation after the generation key be evicted
+	gen := strconv.FormatInt(time.Now().UnixNano(), 10)
+	err = c.handle.Add(&memcache.Item{Key: gk, Value: []byte(gen)})
+	if err == memcache.ErrNotStored {
+		return c.generation(base)
+	}
+	if err != nil {
+		return "", err
+	}
+	return base + gen + ":", nil
+}
+
+// Scan is not supported, memcached cannot enumerate keys
+func (c *Memcache) Scan(pattern string, fn func(key string) error) error {
+	return cache.ErrNotSupported
+}
+
+// Keys is not supported, memcached cannot enumerate keys
+func (c *Memcache) Keys(prefix string) ([]string, error) {
+	return nil, cache.ErrNotSupported
+}
+
+// Jitter returns the jitter of ttl, nil if not set
+func (c *Memcache) Jitter() *cache.Jitter {
+	return c.jitter
+}
+
+// Namespace returns a cacher under the namespace of given name,
+// it shares the memcache client with current cacher,
+// flush of current cacher also flushes the namespace
+func (c *Memcache) Namespace(name string) cache.Cacher {
+	return &Memcache{
+		Name:      c.Name,
+		Prefix:    cache.NamespacePrefix(c.Prefix, name),
+		handle:    c.handle,
+		selector:  c.selector,
+		chunkSize: c.chunkSize,
+		parent:    c,
+		namespace: cache.NamespacePrefix("", name),
+		jitter:    c.jitter,
+		gens:      c.gens,
+	}
+}
+
 // Start new a cacher and start service
 func (c *Memcache) Start(o cache.Options) error {
 	c.Name = o.Name
 	c.Prefix = o.Prefix
-	var host, port string
-	if val, ok := o.Config["host"]; ok {
-		host = val.(string)
-	} else {
-		host = "127.0.0.1"
+	servers, err := servers(o.Config)
+	if err != nil {
+		return err
 	}
-	if val, ok := o.Config["port"]; ok {
-		port = val.(string)
-	} else {
-		port = "11211"
+	if c.jitter, err = cache.NewJitter(o); err != nil {
+		return err
+	}
+	c.selector = new(Selector)
+	if err = c.selector.SetServers(servers...); err != nil {
+		return err
 	}
 
-	c.handle = memcache.New(host + ":" + port)
-	err := c.handle.Set(&memcache.Item{Key: c.Prefix + "foo", Value: []byte("bar")})
+	timeout, err := cache.ConfigDuration(o.Config, "timeout", memcache.DefaultTimeout)
+	if err != nil {
+		return err
+	}
+	maxIdleConns, err := cache.ConfigInt(o.Config, "maxIdleConns", memcache.DefaultMaxIdleConns)
+	if err != nil {
+		return err
+	}
+	healthCheck, err := cache.ConfigDuration(o.Config, "healthCheck", 0)
 	if err != nil {
-		return fmt.Errorf("memcache connect err: %s", err)
+		return err
+	}
+	c.chunkSize, err = cache.ConfigInt(o.Config, "chunkSize", DefaultChunkSize)
+	if err != nil {
+		return err
+	}
+	refresh, err := cache.ConfigDuration(o.Config, "generationRefresh", 0)
+	if err != nil {
+		return err
 	}
+	c.gens = newGenerations(refresh)
+	if c.chunkSize <= 0 {
+		return fmt.Errorf("memcache: invalid chunkSize %d", c.chunkSize)
+	}
+
+	c.handle = memcache.NewFromSelector(c.selector)
+	c.handle.Timeout = timeout
+	c.handle.MaxIdleConns = maxIdleConns
+	if healthCheck <= 0 {
+		if err = c.handle.Ping(); err != nil {
+			return fmt.Errorf("memcache connect err: %s", err)
+		}
+		return nil
+	}
+
+	// with health monitor, down servers are skipped until they are up again
+	if c.selector.check(timeout) == 0 {
+		return fmt.Errorf("memcache connect err: %s", memcache.ErrNoServers)
+	}
+	c.stop = make(chan struct{})
+	go c.selector.monitor(healthCheck, timeout, c.stop)
 	return nil
 }
 
+// Close stops the health monitor and closes idle connections,
+// namespaces share the client, they cannot be used after close
+func (c *Memcache) Close() error {
+	if c.parent != nil {
+		return c.parent.Close()
+	}
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+	return c.handle.Close()
+}
+
+// SetServers changes the memcached servers at runtime without recreating the cacher,
+// a server is an address with optional weight like "10.0.0.1:11211=2"
+func (c *Memcache) SetServers(servers ...string) error {
+	list := make([]Server, len(servers))
+	for i, s := range servers {
+		server, err := ParseServer(s)
+		if err != nil {
+			return err
+		}
+		list[i] = server
+	}
+	return c.selector.SetServers(list...)
+}
+
+// servers returns the memcached servers by the adapter config,
+// servers is a list of addresses with optional weight,
+// host and port are used if servers is not set
+func servers(config map[string]interface{}) ([]Server, error) {
+	list, err := cache.ConfigStrings(config, "servers", nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		host, err := cache.ConfigString(config, "host", "127.0.0.1")
+		if err != nil {
+			return nil, err
+		}
+		port, err := cache.ConfigInt(config, "port", 11211)
+		if err != nil {
+			return nil, err
+		}
+		list = []string{net.JoinHostPort(host, strconv.Itoa(port))}
+	}
+	servers := make([]Server, len(list))
+	for i, s := range list {
+		if servers[i], err = ParseServer(s); err != nil {
+			return nil, err
+		}
+	}
+	return servers, nil
+}
+
 func init() {
 	cache.Register("memcache", New)
 }
@@ -2,6 +2,7 @@ package memcache
 
 import (
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
@@ -25,6 +26,7 @@ func TestCacheMemcache1(t *testing.T) {
 			var v string
 			c.Get("test", &v)
 			So(v, ShouldEqual, "1")
+			So(errors.Is(c.Get("notExist", &v), cache.ErrCacheMiss), ShouldBeTrue)
 		})
 
 		Convey("get gc", func() {
@@ -109,7 +111,11 @@ func TestCacheMemcache1(t *testing.T) {
 		Convey("large item", func() {
 			v := strings.Repeat("A", 1024*1025)
 			err := c.Set("test", v, 30)
-			So(err, ShouldNotBeNil)
+			So(err, ShouldBeNil)
+			var v1 string
+			err = c.Get("test", &v1)
+			So(err, ShouldBeNil)
+			So(v1, ShouldEqual, v)
 			v = strings.Repeat("A", 1024*513)
 			err = c.Set("test2", v, 30)
 			err = c.Set("test3", v, 30)
@@ -120,6 +126,293 @@ func TestCacheMemcache1(t *testing.T) {
 	})
 }
 
+func TestCacheMemcacheScan(t *testing.T) {
+	Convey("cache memcache scan", t, func() {
+		err := c.Scan("*", func(key string) error {
+			return nil
+		})
+		So(err, ShouldEqual, cache.ErrNotSupported)
+		_, err = c.Keys("")
+		So(err, ShouldEqual, cache.ErrNotSupported)
+	})
+}
+
+func TestCacheMemcacheFlush(t *testing.T) {
+	Convey("cache memcache flush by prefix", t, func() {
+		c1 := cache.New(cache.Options{
+			Name:    "testFlush1",
+			Adapter: "memcache",
+			Prefix:  "flush1:",
+		})
+		c2 := cache.New(cache.Options{
+			Name:    "testFlush2",
+			Adapter: "memcache",
+			Prefix:  "flush2:",
+		})
+		c1.Set("test", 1, 10)
+		c2.Set("test", 1, 10)
+
+		err := c1.Flush()
+		So(err, ShouldBeNil)
+		So(c1.Exist("test"), ShouldBeFalse)
+		So(c2.Exist("test"), ShouldBeTrue)
+		c1.Set("test", 1, 10)
+		So(c1.Exist("test"), ShouldBeTrue)
+
+		err = c1.FlushAll()
+		So(err, ShouldBeNil)
+		So(c2.Exist("test"), ShouldBeFalse)
+	})
+}
+
+func TestCacheMemcacheGeneration(t *testing.T) {
+	Convey("cache memcache generation refresh", t, func() {
+		c1 := cache.New(cache.Options{
+			Name:    "testGeneration1",
+			Adapter: "memcache",
+			Prefix:  "generation:",
+			Config:  map[string]interface{}{"generationRefresh": "200ms"},
+		})
+		c2 := cache.New(cache.Options{
+			Name:    "testGeneration2",
+			Adapter: "memcache",
+			Prefix:  "generation:",
+		})
+		c1.Set("test", 1, 10)
+		So(c2.Exist("test"), ShouldBeTrue)
+
+		// a flush of another cacher is seen after the refresh interval
+		So(c2.Flush(), ShouldBeNil)
+		So(c2.Exist("test"), ShouldBeFalse)
+		So(c1.Exist("test"), ShouldBeTrue)
+		time.Sleep(time.Millisecond * 250)
+		So(c1.Exist("test"), ShouldBeFalse)
+
+		// a flush in process is seen at once, by namespaces too
+		ns := c1.Namespace("ns")
+		c1.Set("test", 1, 10)
+		ns.Set("test", 1, 10)
+		So(c1.Flush(), ShouldBeNil)
+		So(c1.Exist("test"), ShouldBeFalse)
+		So(ns.Exist("test"), ShouldBeFalse)
+
+		// without the refresh interval a flush is seen at once by other cachers
+		c2.Set("test", 1, 10)
+		So(c1.Exist("test"), ShouldBeTrue)
+		So(c1.Flush(), ShouldBeNil)
+		So(c2.Exist("test"), ShouldBeFalse)
+	})
+}
+
+func TestCacheMemcacheTags(t *testing.T) {
+	Convey("cache memcache tags", t, func() {
+		c.SetWithTags("user:1:page", "page", 10, "user:1")
+		c.SetWithTags("user:1:json", "json", 10, "user:1", "json")
+		c.SetWithTags("user:2:json", "json", 10, "user:2", "json")
+
+		var v string
+		err := c.Get("user:1:page", &v)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, "page")
+		tags, err := c.(*Memcache).GetWithTags("user:1:json", &v)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, "json")
+		So(tags, ShouldResemble, []string{"json", "user:1"})
+
+		err = c.InvalidateTags("user:1")
+		So(err, ShouldBeNil)
+		So(c.Exist("user:1:page"), ShouldBeFalse)
+		So(c.Exist("user:1:json"), ShouldBeFalse)
+		So(c.Exist("user:2:json"), ShouldBeTrue)
+		_, err = c.(*Memcache).GetWithTags("user:1:json", &v)
+		So(errors.Is(err, cache.ErrCacheMiss), ShouldBeTrue)
+
+		err = c.InvalidateTags("json")
+		So(err, ShouldBeNil)
+		So(c.Exist("user:2:json"), ShouldBeFalse)
+	})
+}
+
+func TestCacheMemcacheNamespace(t *testing.T) {
+	Convey("cache memcache namespace", t, func() {
+		app := cache.New(cache.Options{
+			Name:    "testNamespace",
+			Adapter: "memcache",
+			Prefix:  "app:",
+		})
+		orders := app.Namespace("orders")
+		users := app.Namespace("users")
+		orders.Set("1", "order", 10)
+		users.Set("1", "user", 10)
+		app.Set("1", "app", 10)
+
+		var v string
+		orders.Get("1", &v)
+		So(v, ShouldEqual, "order")
+		users.Get("1", &v)
+		So(v, ShouldEqual, "user")
+
+		err := orders.Flush()
+		So(err, ShouldBeNil)
+		So(orders.Exist("1"), ShouldBeFalse)
+		So(users.Exist("1"), ShouldBeTrue)
+		So(app.Exist("1"), ShouldBeTrue)
+
+		err = app.Flush()
+		So(err, ShouldBeNil)
+		So(users.Exist("1"), ShouldBeFalse)
+	})
+}
+
+func TestCacheMemcacheIncr(t *testing.T) {
+	Convey("cache memcache atomic incr", t, func() {
+		c.Delete("counter")
+		c.Delete("float")
+
+		v, err := c.IncrBy("counter", 5)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, 5)
+		v, err = c.IncrBy("counter", -2)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, 3)
+
+		f, err := c.IncrByFloat("float", 1.5)
+		So(err, ShouldBeNil)
+		So(f, ShouldEqual, 1.5)
+		f, err = c.IncrByFloat("float", 0.25)
+		So(err, ShouldBeNil)
+		So(f, ShouldEqual, 1.75)
+
+		v, err = c.IncrWithTTL("ttl", 1, 1)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, 1)
+		v, err = c.IncrWithTTL("ttl", 1, 10)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, 2)
+		time.Sleep(time.Second * 2)
+		So(c.Exist("ttl"), ShouldBeFalse)
+
+		// IncrByFloat keeps the ttl
+		c.IncrWithTTL("ttl", 1, 1)
+		c.Set("floatTTL", 1.5, 1)
+		f, err = c.IncrByFloat("ttl", 0.5)
+		So(err, ShouldBeNil)
+		So(f, ShouldEqual, 1.5)
+		f, err = c.IncrByFloat("floatTTL", 0.5)
+		So(err, ShouldBeNil)
+		So(f, ShouldEqual, 2)
+		time.Sleep(time.Second * 2)
+		So(c.Exist("ttl"), ShouldBeFalse)
+		So(c.Exist("floatTTL"), ShouldBeFalse)
+	})
+}
+
+func TestCacheMemcacheLock(t *testing.T) {
+	Convey("cache memcache lock", t, func() {
+		store := c.(interface {
+			SetNX(key string, v string, ttl time.Duration) (bool, error)
+			CompareAndDelete(key string, v string) (bool, error)
+			CompareAndExpire(key string, v string, ttl time.Duration) (bool, error)
+		})
+		c.Delete("lock")
+
+		ok, err := store.SetNX("lock", "a", time.Second)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		ok, err = store.SetNX("lock", "b", time.Second)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+
+		ok, err = store.CompareAndExpire("lock", "b", time.Second*10)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+		ok, err = store.CompareAndExpire("lock", "a", time.Second*10)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		time.Sleep(time.Millisecond * 1500)
+		So(c.Exist("lock"), ShouldBeTrue)
+
+		ok, err = store.CompareAndDelete("lock", "b")
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+		ok, err = store.CompareAndDelete("lock", "a")
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		So(c.Exist("lock"), ShouldBeFalse)
+
+		ok, err = store.CompareAndDelete("lock", "a")
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+		ok, err = store.CompareAndExpire("lock", "a", time.Second)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestCacheMemcacheJitter(t *testing.T) {
+	Convey("cache memcache jitter", t, func() {
+		c := cache.New(cache.Options{
+			Name:       "testJitter",
+			Adapter:    "memcache",
+			Prefix:     "jitter:",
+			Jitter:     50,
+			JitterSeed: 1,
+			Config: map[string]interface{}{
+				"host": "127.0.0.1",
+				"port": "11211",
+			},
+		}).(*Memcache)
+		// ttl returns the ttl second of key by its deadline in flags
+		ttl := func(key string) int64 {
+			k, err := c.key(key)
+			So(err, ShouldBeNil)
+			item, err := c.handle.Get(k)
+			So(err, ShouldBeNil)
+			return int64(item.Flags) - time.Now().Unix()
+		}
+		for _, key := range []string{"a", "b", "c"} {
+			c.Delete("counter:" + key)
+			c.Delete("lock:" + key)
+			_, err := c.IncrWithTTL("counter:"+key, 1, 100)
+			So(err, ShouldBeNil)
+			So(ttl("counter:"+key), ShouldBeBetweenOrEqual, 49, 100)
+			_, err = c.SetNX("lock:"+key, "1", 100*time.Second)
+			So(err, ShouldBeNil)
+			So(ttl("lock:"+key), ShouldBeBetweenOrEqual, 49, 100)
+		}
+	})
+}
+
+func TestCacheMemcacheEncoding(t *testing.T) {
+	Convey("cache memcache encoding", t, func() {
+		now := time.Now()
+		c.Set("time", now, 10)
+		c.Set("duration", time.Minute, 10)
+		c.Set("bytes", []byte("raw"), 10)
+		c.Set("string", "abc", 10)
+
+		var tm time.Time
+		err := c.Get("time", &tm)
+		So(err, ShouldBeNil)
+		So(tm.Equal(now), ShouldBeTrue)
+		var d time.Duration
+		err = c.Get("duration", &d)
+		So(err, ShouldBeNil)
+		So(d, ShouldEqual, time.Minute)
+		var b []byte
+		err = c.Get("bytes", &b)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, "raw")
+
+		var n int
+		err = c.Get("string", &n)
+		So(err, ShouldNotBeNil)
+		v, err := c.IncrBy("duration", 1)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, int64(time.Minute)+1)
+	})
+}
+
 func BenchmarkCacheMemorySet(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		c.Set(fmt.Sprintf("test%d", i), 1, 1800)
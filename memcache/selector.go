@@ -0,0 +1,202 @@
+package memcache
+
+import (
+	"crypto/md5"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// ketamaPoints is the number of hashes per server on the ring at the average weight,
+// every hash gives four points
+const ketamaPoints = 40
+
+// Server a memcached server address with its weight
+type Server struct {
+	Addr   string
+	Weight int
+}
+
+// ParseServer parses a server address with optional weight like "10.0.0.1:11211=2",
+// the weight defaults to 1
+func ParseServer(s string) (Server, error) {
+	server := Server{Addr: strings.TrimSpace(s), Weight: 1}
+	if i := strings.LastIndexByte(server.Addr, '='); i >= 0 {
+		w, err := strconv.Atoi(strings.TrimSpace(server.Addr[i+1:]))
+		if err != nil || w <= 0 {
+			return server, fmt.Errorf("memcache: invalid server weight %q", s)
+		}
+		server.Addr, server.Weight = strings.TrimSpace(server.Addr[:i]), w
+	}
+	if server.Addr == "" {
+		return server, fmt.Errorf("memcache: invalid server %q", s)
+	}
+	return server, nil
+}
+
+// Selector picks the memcached server of a key by a ketama consistent hash ring,
+// every server has points on the ring in proportion to its weight,
+// so adding or removing a server only remaps the keys of its own points.
+// Keys of a server marked down are picked by the next live server on the ring.
+type Selector struct {
+	mu    sync.RWMutex
+	addrs []net.Addr
+	ring  []ketamaPoint
+	down  map[string]bool // addresses of down servers
+}
+
+// ketamaPoint a point of the hash ring
+type ketamaPoint struct {
+	hash uint32
+	addr net.Addr
+}
+
+// serverAddr caches the network and address of a resolved server
+type serverAddr struct {
+	network, addr string
+}
+
+func (a *serverAddr) Network() string { return a.network }
+func (a *serverAddr) String() string  { return a.addr }
+
+// SetServers changes the servers at runtime, it is safe for concurrent use,
+// no change is made if any server cannot be resolved
+func (s *Selector) SetServers(servers ...Server) error {
+	var total int
+	addrs := make([]net.Addr, len(servers))
+	for i, server := range servers {
+		if server.Weight <= 0 {
+			return fmt.Errorf("memcache: invalid weight %d of server %s", server.Weight, server.Addr)
+		}
+		if strings.Contains(server.Addr, "/") {
+			addr, err := net.ResolveUnixAddr("unix", server.Addr)
+			if err != nil {
+				return err
+			}
+			addrs[i] = &serverAddr{addr.Network(), addr.String()}
+		} else {
+			addr, err := net.ResolveTCPAddr("tcp", server.Addr)
+			if err != nil {
+				return err
+			}
+			addrs[i] = &serverAddr{addr.Network(), addr.String()}
+		}
+		total += server.Weight
+	}
+
+	var ring []ketamaPoint
+	for i, server := range servers {
+		n := ketamaPoints * len(servers) * server.Weight / total
+		if n == 0 {
+			n = 1
+		}
+		for j := 0; j < n; j++ {
+			digest := md5.Sum([]byte(server.Addr + "-" + strconv.Itoa(j)))
+			for k := 0; k < 4; k++ {
+				ring = append(ring, ketamaPoint{hash: ketamaHash(digest[k*4:]), addr: addrs[i]})
+			}
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].hash < ring[j].hash
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	down := make(map[string]bool)
+	for _, addr := range addrs {
+		if s.down[addr.String()] {
+			down[addr.String()] = true
+		}
+	}
+	s.addrs = addrs
+	s.ring = ring
+	s.down = down
+	return nil
+}
+
+// PickServer returns the server address of given key
+func (s *Selector) PickServer(key string) (net.Addr, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.addrs) == 1 && len(s.down) == 0 {
+		return s.addrs[0], nil
+	}
+	if len(s.ring) == 0 || len(s.down) == len(s.addrs) {
+		return nil, memcache.ErrNoServers
+	}
+	digest := md5.Sum([]byte(key))
+	h := ketamaHash(digest[:])
+	i := sort.Search(len(s.ring), func(i int) bool {
+		return s.ring[i].hash >= h
+	})
+	for ; ; i++ {
+		if i == len(s.ring) {
+			i = 0
+		}
+		if !s.down[s.ring[i].addr.String()] {
+			return s.ring[i].addr, nil
+		}
+	}
+}
+
+// Each calls f for each live server
+func (s *Selector) Each(f func(net.Addr) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, addr := range s.addrs {
+		if s.down[addr.String()] {
+			continue
+		}
+		if err := f(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Down returns the addresses of servers marked down
+func (s *Selector) Down() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var down []string
+	for _, addr := range s.addrs {
+		if s.down[addr.String()] {
+			down = append(down, addr.String())
+		}
+	}
+	return down
+}
+
+// mark marks the server of given address down or up
+func (s *Selector) mark(addr net.Addr, down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !down {
+		delete(s.down, addr.String())
+		return
+	}
+	// the server may be removed by SetServers during health check
+	for _, a := range s.addrs {
+		if a.String() == addr.String() {
+			s.down[a.String()] = true
+		}
+	}
+}
+
+// servers returns all servers, live or down
+func (s *Selector) servers() []net.Addr {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.addrs
+}
+
+// ketamaHash returns the hash of four bytes in little endian like libketama
+func ketamaHash(b []byte) uint32 {
+	return uint32(b[3])<<24 | uint32(b[2])<<16 | uint32(b[1])<<8 | uint32(b[0])
+}
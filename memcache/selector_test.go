@@ -0,0 +1,90 @@
+package memcache
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemcacheSelector(t *testing.T) {
+	Convey("memcache ketama selector", t, func() {
+		Convey("parse server", func() {
+			s, err := ParseServer("10.0.0.1:11211=3")
+			So(err, ShouldBeNil)
+			So(s, ShouldResemble, Server{Addr: "10.0.0.1:11211", Weight: 3})
+			s, err = ParseServer("10.0.0.1:11211")
+			So(err, ShouldBeNil)
+			So(s.Weight, ShouldEqual, 1)
+			_, err = ParseServer("10.0.0.1:11211=0")
+			So(err, ShouldNotBeNil)
+			_, err = ParseServer("=2")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("no servers", func() {
+			s := new(Selector)
+			_, err := s.PickServer("key")
+			So(err, ShouldEqual, memcache.ErrNoServers)
+		})
+
+		Convey("weights", func() {
+			s := new(Selector)
+			err := s.SetServers(
+				Server{Addr: "127.0.0.1:11211", Weight: 1},
+				Server{Addr: "127.0.0.1:11212", Weight: 3},
+			)
+			So(err, ShouldBeNil)
+			count := pick(s, 10000)
+			So(count["127.0.0.1:11212"], ShouldBeBetween, 6500, 8500)
+		})
+
+		Convey("adding a server remaps few keys", func() {
+			s := new(Selector)
+			servers := []Server{
+				{Addr: "127.0.0.1:11211", Weight: 1},
+				{Addr: "127.0.0.1:11212", Weight: 1},
+				{Addr: "127.0.0.1:11213", Weight: 1},
+			}
+			So(s.SetServers(servers...), ShouldBeNil)
+			before := make(map[string]string)
+			for i := 0; i < 10000; i++ {
+				key := "key" + strconv.Itoa(i)
+				addr, _ := s.PickServer(key)
+				before[key] = addr.String()
+			}
+			So(s.SetServers(append(servers, Server{Addr: "127.0.0.1:11214", Weight: 1})...), ShouldBeNil)
+			var moved int
+			for key, addr := range before {
+				a, _ := s.PickServer(key)
+				if a.String() != addr {
+					So(a.String(), ShouldEqual, "127.0.0.1:11214")
+					moved++
+				}
+			}
+			So(moved, ShouldBeBetween, 1500, 3500)
+		})
+
+		Convey("hot update", func() {
+			m := c.(*Memcache)
+			err := m.SetServers("127.0.0.1:11211=2")
+			So(err, ShouldBeNil)
+			err = c.Set("test", "1", 10)
+			So(err, ShouldBeNil)
+			err = m.SetServers("127.0.0.1:11211=x")
+			So(err, ShouldNotBeNil)
+			So(c.Exist("test"), ShouldBeTrue)
+		})
+	})
+}
+
+// pick returns the count of keys picked by each server
+func pick(s *Selector, n int) map[string]int {
+	count := make(map[string]int)
+	for i := 0; i < n; i++ {
+		addr, _ := s.PickServer("key" + strconv.Itoa(i))
+		count[addr.String()]++
+	}
+	return count
+}
@@ -1,8 +1,9 @@
 package cache
 
 import (
-	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,16 +19,47 @@ const (
 	MemoryLimitMin int64 = 1 << 20
 	// MenoryObjectMaxSize maximum bytes for object, 1mb
 	MenoryObjectMaxSize int64 = 1 << 20
+	// memoryEntryOverhead approximate bytes of an entry besides its key and data,
+	// the lru element, map bucket and entry struct
+	memoryEntryOverhead int64 = 128
 )
 
 // Memory implement a memory cache adapter for cacher
 type Memory struct {
-	Name       string
-	Prefix     string
-	bytes      int64
-	bytesLimit int64
-	mu         sync.RWMutex
-	store      *lru.Cache
+	Name   string
+	Prefix string
+	*memoryStore
+}
+
+// memoryStore the storage of memory cacher, shared by namespaces
+type memoryStore struct {
+	bytes       int64
+	bytesLimit  int64
+	mu          sync.RWMutex
+	store       *lru.Cache
+	tags        map[string]map[string]struct{} // tag => keys
+	keyTags     map[string][]string            // key => tags
+	id          string                         // source id of published invalidations
+	bus         Bus                            // invalidation bus, nil if not set
+	unsubscribe func()                         // unsubscribes the bus
+	jitter      *Jitter                        // jitter of ttl, nil if not set
+	version     uint64                         // changed by every write and deletion
+}
+
+// memoryEntry a cached value of the memory storage
+type memoryEntry struct {
+	data       ItemBinary // value encoded in the wire format
+	expiration int64      // expired time in unix nano, 0 never expire
+}
+
+// size returns the bytes counted for entry of given key
+func (e *memoryEntry) size(key string) int64 {
+	return int64(len(key)+len(e.data)) + memoryEntryOverhead
+}
+
+// expired check entry has expired
+func (e *memoryEntry) expired() bool {
+	return e.expiration > 0 && time.Now().UnixNano() >= e.expiration
 }
 
 // NewMemory create a cache instance of memory
@@ -50,22 +82,45 @@ func (c *Memory) Get(key string, out interface{}) error {
 	c.mu.RUnlock()
 	item := c.get(c.Prefix + key)
 	if item == nil {
-		return errors.New("cache: cache miss")
+		return ErrCacheMiss
 	}
 	return item.Decode(out)
 }
 
-func (c *Memory) get(key string) *Item {
-	v, ok := c.store.Get(key)
-	if !ok {
-		return nil
+// GetWithTags returns value by given key like Get, and the tags associated with it
+func (c *Memory) GetWithTags(key string, out interface{}) ([]string, error) {
+	key = c.Prefix + key
+	c.mu.Lock()
+	e := c.entry(key)
+	var tags []string
+	if e != nil {
+		for _, tag := range c.keyTags[key] {
+			tags = append(tags, strings.TrimPrefix(tag, c.Prefix))
+		}
+	}
+	c.mu.Unlock()
+	if e == nil {
+		return nil, ErrCacheMiss
 	}
-	item, err := v.(ItemBinary).Item()
+	sort.Strings(tags)
+	item, err := e.data.Item()
 	if err != nil {
+		return nil, err
+	}
+	return tags, item.Decode(out)
+}
+
+// get returns unexpired item by given key with prefix, the lru moves
+// the key on get, so it must hold the write lock
+func (c *Memory) get(key string) *Item {
+	c.mu.Lock()
+	e := c.entry(key)
+	c.mu.Unlock()
+	if e == nil {
 		return nil
 	}
-	if item.Expired() {
-		c.Delete(key)
+	item, err := e.data.Item()
+	if err != nil {
 		return nil
 	}
 	return item
@@ -73,92 +128,377 @@ func (c *Memory) get(key string) *Item {
 
 // Set cache value by given key, cache ttl second
 func (c *Memory) Set(key string, v interface{}, ttl int64) error {
-	item := NewItem(v, ttl)
-	b, err := item.Encode()
-	if err != nil {
+	if err := c.set(c.Prefix+key, v, ttl, nil); err != nil {
 		return err
 	}
+	return c.publish(&Invalidation{Keys: []string{c.Prefix + key}})
+}
 
-	// if overwrite bytes count will error
-	// so, delete first if exist
-	if c.Exist(key) {
-		c.store.Remove(c.Prefix + key)
+// SetLocal cache value like Set without publishing invalidation to the bus,
+// for caching a value read from a storage shared by other instances
+func (c *Memory) SetLocal(key string, v interface{}, ttl int64) error {
+	return c.set(c.Prefix+key, v, ttl, nil)
+}
+
+// Version returns the version of the storage, it is changed by every write
+// and deletion, including invalidations from the bus
+func (c *Memory) Version() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+// SetLocalIfVersion cache value like SetLocal only if the storage version is
+// still version, returns true if cached. A value read from a shared storage
+// is not cached over a write or deletion made during the read.
+func (c *Memory) SetLocalIfVersion(key string, v interface{}, ttl int64, version uint64) (bool, error) {
+	return c.setIf(c.Prefix+key, v, ttl, nil, &version)
+}
+
+// SetWithTags cache value by given key like Set, and associates it with given tags
+func (c *Memory) SetWithTags(key string, v interface{}, ttl int64, tags ...string) error {
+	if err := c.set(c.Prefix+key, v, ttl, tags); err != nil {
+		return err
+	}
+	return c.publish(&Invalidation{Keys: []string{c.Prefix + key}})
+}
+
+// InvalidateTags delete all cached data associated with given tags
+func (c *Memory) InvalidateTags(tags ...string) error {
+	var keys []string
+	c.mu.Lock()
+	for _, tag := range tags {
+		for key := range c.tags[c.Prefix+tag] {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		c.store.Remove(key)
+	}
+	c.version++
+	c.mu.Unlock()
+	if len(keys) == 0 {
+		return nil
+	}
+	return c.publish(&Invalidation{Keys: keys})
+}
+
+func (c *Memory) set(key string, v interface{}, ttl int64, tags []string) error {
+	_, err := c.setIf(key, v, ttl, tags, nil)
+	return err
+}
+
+// setIf cache value by given key with prefix only if the storage version is
+// *version, nil for any version, returns true if cached
+func (c *Memory) setIf(key string, v interface{}, ttl int64, tags []string, version *uint64) (bool, error) {
+	item := c.jitter.NewItem(v, ttl)
+	b, err := item.Encode()
+	if err != nil {
+		return false, err
 	}
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if version != nil && *version != c.version {
+		return false, nil
+	}
+	c.version++
 
-	l := int64(len(b))
+	// if overwrite bytes count will error
+	// so, delete first if exist
+	c.store.Remove(key)
+
+	e := &memoryEntry{data: b, expiration: item.Expiration}
+	l := e.size(key)
 	err = c.gc(l)
 	if err != nil {
-		return err
+		return false, err
 	}
-	c.store.Add(c.Prefix+key, b)
+	c.store.Add(key, e)
 	c.bytes += l
+	c.tag(key, tags)
 
-	return nil
+	return true, nil
+}
+
+// tag associates key with tags, caller must hold the lock
+func (c *Memory) tag(key string, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+	keyTags := make([]string, len(tags))
+	for i, tag := range tags {
+		tag = c.Prefix + tag
+		if c.tags[tag] == nil {
+			c.tags[tag] = make(map[string]struct{})
+		}
+		c.tags[tag][key] = struct{}{}
+		keyTags[i] = tag
+	}
+	c.keyTags[key] = keyTags
+}
+
+// untag removes key from its tags, caller must hold the lock
+func (c *memoryStore) untag(key string) {
+	for _, tag := range c.keyTags[key] {
+		delete(c.tags[tag], key)
+		if len(c.tags[tag]) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+	delete(c.keyTags, key)
 }
 
 // Incr increases cached int-type value by given key as a counter
 // if key not exist, before increase set value with zero
 func (c *Memory) Incr(key string) (int64, error) {
-	item := c.get(c.Prefix + key)
-	if item == nil {
-		item = NewItem(0, 0)
+	return c.IncrWithTTL(key, 1, 0)
+}
+
+// Decr decreases cached int-type value by given key as a counter
+// if key not exist, before decrease set value with zero
+func (c *Memory) Decr(key string) (int64, error) {
+	return c.IncrWithTTL(key, -1, 0)
+}
+
+// IncrBy increases cached int-type value by given key with delta atomically,
+// if key not exist, before increase set value with zero
+func (c *Memory) IncrBy(key string, delta int64) (int64, error) {
+	return c.IncrWithTTL(key, delta, 0)
+}
+
+// IncrByFloat increases cached numeric value by given key with float delta atomically,
+// if key not exist, before increase set value with zero
+func (c *Memory) IncrByFloat(key string, delta float64) (float64, error) {
+	item, err := c.incr(c.Prefix+key, float64(0), 0, func(item *Item) error {
+		return item.IncrByFloat(delta)
+	})
+	if err != nil {
+		return 0, err
 	}
-	err := item.Incr()
+	return item.Val.(float64), c.publish(&Invalidation{Keys: []string{c.Prefix + key}})
+}
+
+// IncrWithTTL increases cached int-type value by given key with delta atomically,
+// if key not exist, the counter is created with ttl second
+func (c *Memory) IncrWithTTL(key string, delta int64, ttl int64) (int64, error) {
+	item, err := c.incr(c.Prefix+key, int64(0), ttl, func(item *Item) error {
+		return item.IncrBy(delta)
+	})
 	if err != nil {
 		return 0, err
 	}
-	ttl := item.TTL
-	if ttl > 0 {
-		ttl = int64((item.Expiration - time.Now().UnixNano()) / 1e9)
+	return item.Val.(int64), c.publish(&Invalidation{Keys: []string{c.Prefix + key}})
+}
+
+// incr updates cached value by given key with fn in place under the lock,
+// the expiration of an existing value is kept, a new value is created by zero and ttl
+func (c *Memory) incr(key string, zero interface{}, ttl int64, fn func(item *Item) error) (*Item, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var item *Item
+	var size int64
+	if v, ok := c.store.Get(key); ok {
+		e := v.(*memoryEntry)
+		if !e.expired() {
+			old, err := e.data.Item()
+			if err != nil {
+				return nil, err
+			}
+			item = old
+			item.Expiration = e.expiration
+			size = e.size(key)
+		}
+	}
+	if item == nil {
+		// an expired value is replaced by a new counter
+		c.store.Remove(key)
+		item = c.jitter.NewItem(zero, ttl)
 	}
-	if ttl < 0 {
-		return 0, fmt.Errorf("cache: expired")
+	if err := fn(item); err != nil {
+		return nil, err
 	}
-	err = c.Set(key, item.Val, ttl)
+	b, err := item.Encode()
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+
+	e := &memoryEntry{data: b, expiration: item.Expiration}
+	l := e.size(key)
+	if size == 0 {
+		if err = c.gc(l); err != nil {
+			return nil, err
+		}
 	}
-	return item.Val.(int64), nil
+	// update in place keeps the lru element and tags of the key
+	c.store.Add(key, e)
+	c.bytes += l - size
+	c.version++
+	return item, nil
 }
 
-// Decr decreases cached int-type value by given key as a counter
-// if key not exist, return errors
-func (c *Memory) Decr(key string) (int64, error) {
-	item := c.get(c.Prefix + key)
-	if item == nil {
-		item = NewItem(0, 0)
+// entry returns the unexpired entry by given key with prefix,
+// an expired entry is removed, caller must hold the lock
+func (c *memoryStore) entry(key string) *memoryEntry {
+	v, ok := c.store.Get(key)
+	if !ok {
+		return nil
 	}
-	err := item.Decr()
+	e := v.(*memoryEntry)
+	if e.expired() {
+		c.store.Remove(key)
+		return nil
+	}
+	return e
+}
+
+// SetNX cache value by given key only if the key does not exist, returns true if cached.
+// It is for locks of one process, the ttl is a duration for sub-second locks,
+// the value is not published to the bus.
+func (c *Memory) SetNX(key string, v string, ttl time.Duration) (bool, error) {
+	key = c.Prefix + key
+	b, err := NewItem(v, 0).Encode()
 	if err != nil {
-		return 0, err
+		return false, err
 	}
-	ttl := item.TTL
-	if ttl > 0 {
-		ttl = int64((item.Expiration - time.Now().UnixNano()) / 1e9)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entry(key) != nil {
+		return false, nil
+	}
+	e := &memoryEntry{data: b, expiration: expiration(c.jitter.Duration(ttl))}
+	l := e.size(key)
+	if err = c.gc(l); err != nil {
+		return false, err
+	}
+	c.store.Add(key, e)
+	c.bytes += l
+	c.version++
+	return true, nil
+}
+
+// CompareAndDelete delete cached data by given key only if its value is v, returns true if deleted
+func (c *Memory) CompareAndDelete(key string, v string) (bool, error) {
+	key = c.Prefix + key
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entry(key)
+	if e == nil || string(e.data) != string(encodeString(v)) {
+		return false, nil
+	}
+	c.store.Remove(key)
+	c.version++
+	return true, nil
+}
+
+// CompareAndExpire sets ttl of cached data by given key only if its value is v, returns true if set
+func (c *Memory) CompareAndExpire(key string, v string, ttl time.Duration) (bool, error) {
+	key = c.Prefix + key
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entry(key)
+	if e == nil || string(e.data) != string(encodeString(v)) {
+		return false, nil
+	}
+	e.expiration = expiration(ttl)
+	return true, nil
+}
+
+// Update replaces cached data by given key with the value returned by fn atomically,
+// fn gets nil if the key does not exist. It is for counters of one process like rate limits,
+// the value is not published to the bus.
+func (c *Memory) Update(key string, fn func(old []byte) ([]byte, time.Duration, error)) error {
+	key = c.Prefix + key
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var old []byte
+	var size int64
+	if e := c.entry(key); e != nil {
+		item, err := e.data.Item()
+		if err != nil {
+			return err
+		}
+		if err = item.Decode(&old); err != nil {
+			return err
+		}
+		size = e.size(key)
 	}
-	if ttl < 0 {
-		return 0, fmt.Errorf("cache: expired")
+	v, ttl, err := fn(old)
+	if err != nil {
+		return err
 	}
-	err = c.Set(key, item.Val, ttl)
+	b, err := NewItem(v, 0).Encode()
 	if err != nil {
-		return 0, err
+		return err
 	}
-	return item.Val.(int64), nil
+
+	e := &memoryEntry{data: b, expiration: expiration(ttl)}
+	l := e.size(key)
+	if size == 0 {
+		if err = c.gc(l); err != nil {
+			return err
+		}
+	}
+	c.store.Add(key, e)
+	c.bytes += l - size
+	c.version++
+	return nil
+}
+
+// expiration returns the expired time in unix nano after ttl, 0 never expire
+func expiration(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return time.Now().Add(ttl).UnixNano()
 }
 
 // Delete delete cached data by given key
 func (c *Memory) Delete(key string) error {
+	c.remove(c.Prefix + key)
+	return c.publish(&Invalidation{Keys: []string{c.Prefix + key}})
+}
+
+// remove delete cached data by given key with prefix
+func (c *Memory) remove(key string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.store.Remove(c.Prefix + key)
-	return nil
+	c.store.Remove(key)
+	c.version++
 }
 
-// Flush flush cacher
+// Flush delete all cached data under the cache prefix
 func (c *Memory) Flush() error {
+	if c.Prefix == "" {
+		return c.FlushAll()
+	}
+	c.removePrefix(c.Prefix)
+	return c.publish(&Invalidation{Prefix: c.Prefix})
+}
+
+// FlushAll delete all cached data of the memory storage
+func (c *Memory) FlushAll() error {
+	c.removeAll()
+	return c.publish(&Invalidation{All: true})
+}
+
+// removePrefix delete all cached data with given key prefix
+func (c *memoryStore) removePrefix(prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range c.store.Keys() {
+		if strings.HasPrefix(key.(string), prefix) {
+			c.store.Remove(key)
+		}
+	}
+	c.version++
+}
+
+// removeAll delete all cached data
+func (c *memoryStore) removeAll() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	var l int
@@ -171,38 +511,161 @@ func (c *Memory) Flush() error {
 		}
 	}
 	c.bytes = 0
+	c.version++
+}
 
+// publish sends invalidation to other instances by the bus
+func (c *memoryStore) publish(inv *Invalidation) error {
+	if c.bus == nil {
+		return nil
+	}
+	inv.Source = c.id
+	return c.bus.Publish(inv)
+}
+
+// invalidate deletes cached data by invalidation from other instances
+func (c *memoryStore) invalidate(inv *Invalidation) {
+	if inv.Source == c.id {
+		return
+	}
+	if inv.All {
+		c.removeAll()
+		return
+	}
+	if inv.Prefix != "" {
+		c.removePrefix(inv.Prefix)
+	}
+	if len(inv.Keys) > 0 {
+		c.mu.Lock()
+		for _, key := range inv.Keys {
+			c.store.Remove(key)
+		}
+		c.version++
+		c.mu.Unlock()
+	}
+}
+
+// Close unsubscribes the invalidation bus
+func (c *Memory) Close() error {
+	if c.unsubscribe != nil {
+		c.unsubscribe()
+		c.unsubscribe = nil
+	}
+	return nil
+}
+
+// Scan calls fn for each cached key matching given glob pattern,
+// the iteration stops when fn returns an error
+func (c *Memory) Scan(pattern string, fn func(key string) error) error {
+	for _, key := range c.keys() {
+		if !matchPattern(pattern, key) {
+			continue
+		}
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// Keys returns cached keys which start with given prefix
+func (c *Memory) Keys(prefix string) ([]string, error) {
+	var keys []string
+	for _, key := range c.keys() {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// keys returns the unexpired keys under the cache prefix, without prefix
+func (c *Memory) keys() []string {
+	c.mu.RLock()
+	all := c.store.Keys()
+	c.mu.RUnlock()
+
+	keys := make([]string, 0, len(all))
+	for _, k := range all {
+		key := k.(string)
+		if !strings.HasPrefix(key, c.Prefix) {
+			continue
+		}
+		if c.get(key) == nil {
+			continue
+		}
+		keys = append(keys, key[len(c.Prefix):])
+	}
+	return keys
+}
+
+// Jitter returns the jitter of ttl, nil if not set
+func (c *Memory) Jitter() *Jitter {
+	return c.jitter
+}
+
+// Namespace returns a cacher under the namespace of given name,
+// it shares the memory storage with current cacher
+func (c *Memory) Namespace(name string) Cacher {
+	return &Memory{
+		Name:        c.Name,
+		Prefix:      NamespacePrefix(c.Prefix, name),
+		memoryStore: c.memoryStore,
+	}
+}
+
 // Start new a cacher and start service
 func (c *Memory) Start(o Options) error {
 	c.Name = o.Name
 	c.Prefix = o.Prefix
-	c.bytesLimit = MemoryLimit
-	if o.Config != nil {
-		if v, ok := o.Config["bytesLimit"].(int64); ok {
-			c.bytesLimit = v
-		}
+	if c.memoryStore == nil {
+		c.memoryStore = newMemoryStore()
+	}
+	var err error
+	c.bytesLimit, err = ConfigInt64(o.Config, "bytesLimit", MemoryLimit)
+	if err != nil {
+		return err
 	}
 	if c.bytesLimit < MemoryLimitMin {
 		c.bytesLimit = MemoryLimitMin
 	}
+	if c.jitter, err = NewJitter(o); err != nil {
+		return err
+	}
 
-	if c.store == nil {
-		c.store = lru.New(0)
-		c.store.OnEvicted = func(key lru.Key, value interface{}) {
-			c.bytes -= int64(len(value.(ItemBinary)))
+	if v, ok := ConfigValue(o.Config, "bus"); ok && v != nil {
+		bus, ok := v.(Bus)
+		if !ok {
+			return configError("bus", "cache.Bus", v)
+		}
+		if c.unsubscribe != nil {
+			c.unsubscribe()
 		}
+		c.bus = bus
+		c.unsubscribe = bus.Subscribe(c.invalidate)
 	}
 
 	return nil
 }
 
+func newMemoryStore() *memoryStore {
+	s := &memoryStore{
+		store:   lru.New(0),
+		tags:    make(map[string]map[string]struct{}),
+		keyTags: make(map[string][]string),
+		id:      newSourceID(),
+	}
+	s.store.OnEvicted = func(key lru.Key, value interface{}) {
+		s.bytes -= value.(*memoryEntry).size(key.(string))
+		s.untag(key.(string))
+	}
+	return s
+}
+
 // gc release memory for storage new item
 // if free bytes can store item returns
 // remove items until bytes less than bytesLimit - size
-func (c *Memory) gc(size int64) error {
+func (c *memoryStore) gc(size int64) error {
 	if c.bytes+size < c.bytesLimit {
 		return nil
 	}
@@ -2,9 +2,11 @@ package cache
 
 import (
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -158,6 +160,296 @@ func TestCacheMemory1(t *testing.T) {
 	})
 }
 
+func TestCacheMemoryScan(t *testing.T) {
+	c := New(Options{
+		Name:    "testScan",
+		Adapter: "memory",
+		Prefix:  "scan:",
+	})
+
+	Convey("cache memory scan", t, func() {
+		c.Set("user:1", "a", 10)
+		c.Set("user:2", "b", 10)
+		c.Set("order:1", "c", 10)
+
+		Convey("scan", func() {
+			var keys []string
+			err := c.Scan("user:*", func(key string) error {
+				keys = append(keys, key)
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(keys, ShouldHaveLength, 2)
+			So(keys, ShouldContain, "user:1")
+			So(keys, ShouldContain, "user:2")
+		})
+
+		Convey("scan stop", func() {
+			stop := errors.New("stop")
+			n := 0
+			err := c.Scan("*", func(key string) error {
+				n++
+				return stop
+			})
+			So(err, ShouldEqual, stop)
+			So(n, ShouldEqual, 1)
+		})
+
+		Convey("keys", func() {
+			keys, err := c.Keys("order:")
+			So(err, ShouldBeNil)
+			So(keys, ShouldResemble, []string{"order:1"})
+			keys, err = c.Keys("")
+			So(err, ShouldBeNil)
+			So(keys, ShouldHaveLength, 3)
+		})
+	})
+}
+
+func TestCacheMemoryFlush(t *testing.T) {
+	c := New(Options{
+		Name:    "testFlush",
+		Adapter: "memory",
+		Prefix:  "flush:",
+	})
+
+	Convey("cache memory flush", t, func() {
+		c.Set("test1", "a", 10)
+		c.Set("test2", "b", 10)
+
+		err := c.Flush()
+		So(err, ShouldBeNil)
+		So(c.Exist("test1"), ShouldBeFalse)
+		So(c.Exist("test2"), ShouldBeFalse)
+
+		c.Set("test1", "a", 10)
+		err = c.FlushAll()
+		So(err, ShouldBeNil)
+		So(c.Exist("test1"), ShouldBeFalse)
+	})
+}
+
+func TestCacheMemoryTags(t *testing.T) {
+	c := New(Options{
+		Name:    "testTags",
+		Adapter: "memory",
+		Prefix:  "tags:",
+	})
+
+	Convey("cache memory tags", t, func() {
+		c.SetWithTags("user:1:page", "page", 10, "user:1")
+		c.SetWithTags("user:1:json", "json", 10, "user:1", "json")
+		c.SetWithTags("user:2:json", "json", 10, "user:2", "json")
+
+		Convey("get with tags", func() {
+			var v string
+			tags, err := c.(*Memory).GetWithTags("user:1:json", &v)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "json")
+			So(tags, ShouldResemble, []string{"json", "user:1"})
+			c.Set("plain", "plain", 10)
+			tags, err = c.(*Memory).GetWithTags("plain", &v)
+			So(err, ShouldBeNil)
+			So(tags, ShouldBeEmpty)
+			_, err = c.(*Memory).GetWithTags("notExist", &v)
+			So(err, ShouldEqual, ErrCacheMiss)
+		})
+
+		Convey("invalidate", func() {
+			err := c.InvalidateTags("user:1")
+			So(err, ShouldBeNil)
+			So(c.Exist("user:1:page"), ShouldBeFalse)
+			So(c.Exist("user:1:json"), ShouldBeFalse)
+			So(c.Exist("user:2:json"), ShouldBeTrue)
+		})
+
+		Convey("overwrite without tags", func() {
+			c.Set("user:1:page", "page", 10)
+			err := c.InvalidateTags("user:1")
+			So(err, ShouldBeNil)
+			So(c.Exist("user:1:page"), ShouldBeTrue)
+			So(c.Exist("user:1:json"), ShouldBeFalse)
+		})
+
+		Convey("invalidate multiple", func() {
+			err := c.InvalidateTags("json", "notExist")
+			So(err, ShouldBeNil)
+			So(c.Exist("user:1:page"), ShouldBeTrue)
+			So(c.Exist("user:1:json"), ShouldBeFalse)
+			So(c.Exist("user:2:json"), ShouldBeFalse)
+		})
+	})
+}
+
+func TestCacheMemoryNamespace(t *testing.T) {
+	c := New(Options{
+		Name:    "testNamespace",
+		Adapter: "memory",
+		Prefix:  "app:",
+	})
+
+	Convey("cache memory namespace", t, func() {
+		orders := c.Namespace("orders")
+		users := c.Namespace("users")
+		orders.Set("1", "order", 10)
+		users.Set("1", "user", 10)
+		c.Set("1", "app", 10)
+
+		var v string
+		orders.Get("1", &v)
+		So(v, ShouldEqual, "order")
+		users.Get("1", &v)
+		So(v, ShouldEqual, "user")
+		c.Get("orders:1", &v)
+		So(v, ShouldEqual, "order")
+
+		keys, err := orders.Keys("")
+		So(err, ShouldBeNil)
+		So(keys, ShouldResemble, []string{"1"})
+
+		err = orders.Flush()
+		So(err, ShouldBeNil)
+		So(orders.Exist("1"), ShouldBeFalse)
+		So(users.Exist("1"), ShouldBeTrue)
+		So(c.Exist("1"), ShouldBeTrue)
+
+		err = c.Flush()
+		So(err, ShouldBeNil)
+		So(users.Exist("1"), ShouldBeFalse)
+	})
+}
+
+func TestCacheMemoryIncr(t *testing.T) {
+	Convey("cache memory atomic incr", t, func() {
+		c := New(Options{
+			Name:    "testIncr",
+			Adapter: "memory",
+		})
+
+		Convey("concurrent incr", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 20; j++ {
+						c.IncrBy("counter", 2)
+					}
+				}()
+			}
+			wg.Wait()
+			var v int64
+			err := c.Get("counter", &v)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, 2000)
+		})
+
+		Convey("incr with ttl", func() {
+			v, err := c.IncrWithTTL("ttl", 5, 1)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, 5)
+			time.Sleep(time.Millisecond * 600)
+			v, err = c.IncrWithTTL("ttl", -2, 10)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, 3)
+			time.Sleep(time.Millisecond * 600)
+			So(c.Exist("ttl"), ShouldBeFalse)
+		})
+
+		Convey("incr keeps ttl", func() {
+			c.Set("keep", 1, 1)
+			time.Sleep(time.Millisecond * 600)
+			v, err := c.Incr("keep")
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, 2)
+			time.Sleep(time.Millisecond * 600)
+			So(c.Exist("keep"), ShouldBeFalse)
+		})
+
+		Convey("incr by float", func() {
+			f, err := c.IncrByFloat("float", 1.5)
+			So(err, ShouldBeNil)
+			So(f, ShouldEqual, 1.5)
+			f, err = c.IncrByFloat("float", 0.25)
+			So(err, ShouldBeNil)
+			So(f, ShouldEqual, 1.75)
+			c.Set("int", 2, 10)
+			f, err = c.IncrByFloat("int", 0.5)
+			So(err, ShouldBeNil)
+			So(f, ShouldEqual, 2.5)
+			c.Set("string", "a", 10)
+			_, err = c.IncrByFloat("string", 0.5)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestCacheMemoryUpdate(t *testing.T) {
+	Convey("cache memory atomic update", t, func() {
+		c := New(Options{
+			Name:    "testUpdate",
+			Adapter: "memory",
+		}).(*Memory)
+
+		// appends a byte per update, concurrent updates are never lost
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.Update("log", func(old []byte) ([]byte, time.Duration, error) {
+					return append(old, 'x'), time.Second, nil
+				})
+			}()
+		}
+		wg.Wait()
+		var v string
+		So(c.Get("log", &v), ShouldBeNil)
+		So(v, ShouldEqual, strings.Repeat("x", 20))
+
+		err := c.Update("log", func(old []byte) ([]byte, time.Duration, error) {
+			return nil, 0, errors.New("update failed")
+		})
+		So(err, ShouldNotBeNil)
+		So(c.Get("log", &v), ShouldBeNil)
+		So(len(v), ShouldEqual, 20)
+
+		err = c.Update("ttl", func(old []byte) ([]byte, time.Duration, error) {
+			So(old, ShouldBeNil)
+			return []byte("1"), time.Millisecond * 100, nil
+		})
+		So(err, ShouldBeNil)
+		So(c.Exist("ttl"), ShouldBeTrue)
+		time.Sleep(time.Millisecond * 150)
+		So(c.Exist("ttl"), ShouldBeFalse)
+	})
+}
+
+func TestCacheMemoryEncoding(t *testing.T) {
+	Convey("cache memory encoding", t, func() {
+		c := New(Options{
+			Name:    "testEncoding",
+			Adapter: "memory",
+		})
+		now := time.Now()
+		c.Set("time", now, 10)
+		c.Set("bytes", []byte("raw"), 10)
+		c.Set("string", "abc", 10)
+
+		var tm time.Time
+		err := c.Get("time", &tm)
+		So(err, ShouldBeNil)
+		So(tm.Equal(now), ShouldBeTrue)
+		var b []byte
+		err = c.Get("bytes", &b)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, "raw")
+		var n int
+		err = c.Get("string", &n)
+		So(err, ShouldNotBeNil)
+	})
+}
+
 func BenchmarkCacheMemorySet(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		testCache.Set(fmt.Sprintf("test%d", i), 1, 1800)
@@ -0,0 +1,29 @@
+package cache
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMatchPattern(t *testing.T) {
+	Convey("match pattern", t, func() {
+		So(matchPattern("*", ""), ShouldBeTrue)
+		So(matchPattern("*", "user:1"), ShouldBeTrue)
+		So(matchPattern("user:*", "user:1"), ShouldBeTrue)
+		So(matchPattern("user:*", "order:1"), ShouldBeFalse)
+		So(matchPattern("*:1", "user:1"), ShouldBeTrue)
+		So(matchPattern("user:?", "user:12"), ShouldBeFalse)
+		So(matchPattern("user:??", "user:12"), ShouldBeTrue)
+		So(matchPattern("h[ae]llo", "hallo"), ShouldBeTrue)
+		So(matchPattern("h[ae]llo", "hillo"), ShouldBeFalse)
+		So(matchPattern("h[^e]llo", "hallo"), ShouldBeTrue)
+		So(matchPattern("h[^e]llo", "hello"), ShouldBeFalse)
+		So(matchPattern("h[a-c]llo", "hbllo"), ShouldBeTrue)
+		So(matchPattern("h[a-c]llo", "hdllo"), ShouldBeFalse)
+		So(matchPattern(`user\*`, "user*"), ShouldBeTrue)
+		So(matchPattern(`user\*`, "user1"), ShouldBeFalse)
+		So(matchPattern("a*b*c", "axxbyyc"), ShouldBeTrue)
+		So(matchPattern("a*b*c", "axxbyy"), ShouldBeFalse)
+	})
+}
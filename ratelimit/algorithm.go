@@ -0,0 +1,158 @@
+package ratelimit
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The algorithms in go for Updater stores, they match the lua scripts of Evaler
+// stores. Every algorithm gets the state of a key, the time now, the limit,
+// the period in milliseconds and the requests to count, it returns the next state,
+// its ttl in milliseconds and the result.
+
+// fixedWindow state: count of the window
+func fixedWindow(s []float64, now, limit, period, n int64) ([]float64, int64, *Result) {
+	var count int64
+	if len(s) == 1 {
+		count = int64(s[0])
+	}
+	reset := period - now%period
+	if count+n > limit {
+		return []float64{float64(count)}, reset, &Result{Remaining: limit - count, RetryAfter: ms(reset)}
+	}
+	count += n
+	return []float64{float64(count)}, reset, &Result{Allowed: true, Remaining: limit - count}
+}
+
+// slidingLog state: times of requests in the last period, ascending
+func slidingLog(s []float64, now, limit, period, n int64) ([]float64, int64, *Result) {
+	sort.Float64s(s)
+	log := s[:0]
+	for _, t := range s {
+		if int64(t) > now-period {
+			log = append(log, t)
+		}
+	}
+	count := int64(len(log))
+	if count+n > limit {
+		// the request waits until enough logged requests leave the period
+		t := int64(log[count+n-limit-1])
+		return log, period, &Result{Remaining: limit - count, RetryAfter: ms(t + period - now)}
+	}
+	for i := int64(0); i < n; i++ {
+		log = append(log, float64(now))
+	}
+	return log, period, &Result{Allowed: true, Remaining: limit - count - n}
+}
+
+// slidingWindow state: index of the current window, counts of the previous and the current window
+func slidingWindow(s []float64, now, limit, period, n int64) ([]float64, int64, *Result) {
+	w := now / period
+	var prev, cur int64
+	if len(s) == 3 {
+		switch int64(s[0]) {
+		case w:
+			prev, cur = int64(s[1]), int64(s[2])
+		case w - 1:
+			prev = int64(s[2])
+		}
+	}
+	elapsed := now - w*period
+	weighted := prev * (period - elapsed) / period
+	state := func() []float64 { return []float64{float64(w), float64(prev), float64(cur)} }
+	if weighted+cur+n > limit {
+		var retry int64
+		if r := limit - cur - n; r >= 0 {
+			retry = decay(prev, r, period) - elapsed
+		} else {
+			// the current count is too much even without the previous window,
+			// wait for the next window with it as the previous
+			retry = period - elapsed + decay(cur, limit-n, period)
+		}
+		remaining := limit - weighted - cur
+		if remaining < 0 {
+			remaining = 0
+		}
+		return state(), 2*period - elapsed, &Result{Remaining: remaining, RetryAfter: ms(retry)}
+	}
+	cur += n
+	return state(), 2*period - elapsed, &Result{Allowed: true, Remaining: limit - weighted - cur}
+}
+
+// decay returns the elapsed milliseconds of a window, when the weighted count
+// count * (period - elapsed) / period of the previous window drops to r
+func decay(count, r, period int64) int64 {
+	if count <= r {
+		return 0
+	}
+	e := period - ((r+1)*period+count-1)/count + 1
+	if e < 0 {
+		return 0
+	}
+	return e
+}
+
+// tokenBucket state: tokens in the bucket, time of the last update
+func tokenBucket(s []float64, now, limit, period, n, burst int64) ([]float64, int64, *Result) {
+	tokens := float64(burst)
+	if len(s) == 2 {
+		tokens = s[0]
+		if elapsed := now - int64(s[1]); elapsed > 0 {
+			tokens = math.Min(float64(burst), tokens+float64(elapsed)*float64(limit)/float64(period))
+		}
+	}
+	if tokens < float64(n) {
+		retry := int64(math.Ceil((float64(n) - tokens) * float64(period) / float64(limit)))
+		return []float64{tokens, float64(now)}, full(tokens, limit, period, burst),
+			&Result{Remaining: int64(tokens), RetryAfter: ms(retry)}
+	}
+	tokens -= float64(n)
+	return []float64{tokens, float64(now)}, full(tokens, limit, period, burst),
+		&Result{Allowed: true, Remaining: int64(tokens)}
+}
+
+// full returns the milliseconds to refill the bucket, after it the state is not needed
+func full(tokens float64, limit, period, burst int64) int64 {
+	ttl := int64(math.Ceil((float64(burst) - tokens) * float64(period) / float64(limit)))
+	if ttl < 1 {
+		return 1
+	}
+	return ttl
+}
+
+// ms returns the duration of milliseconds
+func ms(v int64) time.Duration {
+	return time.Duration(v) * time.Millisecond
+}
+
+// parseState parses the state stored as comma separated numbers
+func parseState(b []byte) ([]float64, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	fields := strings.Split(string(b), ",")
+	s := make([]float64, len(fields))
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil, err
+		}
+		s[i] = v
+	}
+	return s, nil
+}
+
+// formatState formats the state as comma separated numbers
+func formatState(s []float64) []byte {
+	var b []byte
+	for i, v := range s {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = strconv.AppendFloat(b, v, 'f', -1, 64)
+	}
+	return b
+}
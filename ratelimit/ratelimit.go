@@ -0,0 +1,233 @@
+// Package ratelimit providers rate limiters built on cacher, by fixed window,
+// sliding window log, sliding window counter and token bucket algorithms.
+//
+// A limit is checked and counted in one atomic step: by lua scripts on redis,
+// under the lock on memory, and by cas on memcache, which is best effort,
+// as its ttl is rounded up to seconds and an update gives up on heavy conflicts.
+// Tiered limits on its L2. Time is taken from the app instance, so instances
+// sharing a limit should keep their clocks in sync.
+package ratelimit
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/go-baa/cache"
+)
+
+// Algorithm the algorithm of a limiter
+type Algorithm int
+
+const (
+	// FixedWindow counts requests in windows of a period aligned to the unix epoch,
+	// cheap but allows up to twice the limit around a window boundary
+	FixedWindow Algorithm = iota
+	// SlidingLog logs the time of every request in the last period, exact,
+	// but stores a timestamp per request
+	SlidingLog
+	// SlidingWindow estimates the requests in the last period from the counts
+	// of the current and the previous fixed window, weighted by their overlap
+	SlidingWindow
+	// TokenBucket refills a bucket of Burst tokens at Limit per period,
+	// every request takes a token, it allows bursts up to Burst
+	TokenBucket
+)
+
+// String returns the name of the algorithm
+func (a Algorithm) String() string {
+	switch a {
+	case FixedWindow:
+		return "fixed window"
+	case SlidingLog:
+		return "sliding log"
+	case SlidingWindow:
+		return "sliding window"
+	case TokenBucket:
+		return "token bucket"
+	}
+	return "unknown"
+}
+
+// Evaler runs lua scripts atomically, implemented by adapter redis
+type Evaler interface {
+	// Eval runs a lua script with keys under the cache prefix
+	Eval(script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// Updater replaces values atomically, implemented by adapters memory and memcache
+type Updater interface {
+	// Update replaces cached data by given key with the value returned by fn,
+	// fn gets nil if the key does not exist
+	Update(key string, fn func(old []byte) ([]byte, time.Duration, error)) error
+}
+
+// Options limiter options
+type Options struct {
+	Algorithm Algorithm
+	Limit     int64         // requests allowed in a period
+	Period    time.Duration // length of the period, at least a millisecond
+	Burst     int64         // bucket size of TokenBucket, default Limit
+}
+
+// Result the result of a limit check
+type Result struct {
+	Limit      int64         // requests allowed in a period, Burst of TokenBucket
+	Allowed    bool          // whether the request is allowed
+	Remaining  int64         // requests allowed after this one
+	RetryAfter time.Duration // wait before the denied request may be allowed, -1 if it never will
+}
+
+// Limiter limits requests by keys on a cacher
+type Limiter struct {
+	evaler  Evaler
+	updater Updater
+	deleter cache.Cacher
+	opt     Options
+	now     func() time.Time
+}
+
+// New create a limiter on c, returns cache.ErrNotSupported if the adapter cannot support it
+func New(c cache.Cacher, o Options) (*Limiter, error) {
+	if o.Algorithm < FixedWindow || o.Algorithm > TokenBucket {
+		return nil, fmt.Errorf("ratelimit: unknown algorithm %d", o.Algorithm)
+	}
+	if o.Limit <= 0 {
+		return nil, fmt.Errorf("ratelimit: limit must be positive, got %d", o.Limit)
+	}
+	if o.Period < time.Millisecond {
+		return nil, fmt.Errorf("ratelimit: period must be at least a millisecond, got %s", o.Period)
+	}
+	if o.Burst < 0 {
+		return nil, fmt.Errorf("ratelimit: burst must not be negative, got %d", o.Burst)
+	}
+	if o.Burst == 0 {
+		o.Burst = o.Limit
+	}
+
+	// limits of tiered live in L2 only, an L1 copy is never right
+	if t, ok := c.(interface{ L2() cache.Cacher }); ok {
+		c = t.L2()
+	}
+	l := &Limiter{deleter: c, opt: o, now: time.Now}
+	if e, ok := c.(Evaler); ok {
+		l.evaler = e
+	} else if u, ok := c.(Updater); ok {
+		l.updater = u
+	} else {
+		return nil, cache.ErrNotSupported
+	}
+	return l, nil
+}
+
+// Allow checks and counts a request by given key
+func (l *Limiter) Allow(key string) (*Result, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN checks and counts n requests by given key at once, they are allowed or denied together
+func (l *Limiter) AllowN(key string, n int64) (*Result, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("ratelimit: n must not be negative, got %d", n)
+	}
+	limit := l.opt.Limit
+	if l.opt.Algorithm == TokenBucket {
+		limit = l.opt.Burst
+	}
+	if n > limit {
+		return &Result{Limit: limit, RetryAfter: -1}, nil
+	}
+
+	now := l.now().UnixNano() / int64(time.Millisecond)
+	period := l.opt.Period.Milliseconds()
+	key = l.key(key, now)
+	var r *Result
+	var err error
+	if l.evaler != nil {
+		r, err = l.eval(key, now, period, n)
+	} else {
+		r, err = l.update(key, now, period, n)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.Limit = limit
+	return r, nil
+}
+
+// Reset deletes the state of given key, its requests are counted from zero
+func (l *Limiter) Reset(key string) error {
+	return l.deleter.Delete(l.key(key, l.now().UnixNano()/int64(time.Millisecond)))
+}
+
+// key returns the storage key of given key at now millisecond,
+// a fixed window key is suffixed by the window index
+func (l *Limiter) key(key string, now int64) string {
+	if l.opt.Algorithm == FixedWindow {
+		return key + ":" + strconv.FormatInt(now/l.opt.Period.Milliseconds(), 10)
+	}
+	return key
+}
+
+// eval checks the limit by the lua script of the algorithm
+func (l *Limiter) eval(key string, now, period, n int64) (*Result, error) {
+	var v interface{}
+	var err error
+	switch l.opt.Algorithm {
+	case FixedWindow:
+		v, err = l.evaler.Eval(fixedWindowScript, []string{key}, now, l.opt.Limit, period, n)
+	case SlidingLog:
+		id := strconv.FormatInt(now, 36) + "-" + strconv.FormatInt(rand.Int63(), 36)
+		v, err = l.evaler.Eval(slidingLogScript, []string{key}, now, l.opt.Limit, period, n, id)
+	case SlidingWindow:
+		v, err = l.evaler.Eval(slidingWindowScript, []string{key}, now, l.opt.Limit, period, n)
+	case TokenBucket:
+		v, err = l.evaler.Eval(tokenBucketScript, []string{key}, now, l.opt.Limit, period, n, l.opt.Burst)
+	}
+	if err != nil {
+		return nil, err
+	}
+	a, ok := v.([]interface{})
+	if !ok || len(a) != 3 {
+		return nil, fmt.Errorf("ratelimit: unexpected script result %v", v)
+	}
+	x := make([]int64, len(a))
+	for i := range a {
+		if x[i], ok = a[i].(int64); !ok {
+			return nil, fmt.Errorf("ratelimit: unexpected script result %v", v)
+		}
+	}
+	return &Result{
+		Allowed:    x[0] == 1,
+		Remaining:  x[1],
+		RetryAfter: time.Duration(x[2]) * time.Millisecond,
+	}, nil
+}
+
+// update checks the limit by the algorithm in go, the state is replaced atomically
+func (l *Limiter) update(key string, now, period, n int64) (*Result, error) {
+	var r *Result
+	err := l.updater.Update(key, func(old []byte) ([]byte, time.Duration, error) {
+		s, err := parseState(old)
+		if err != nil {
+			return nil, 0, err
+		}
+		var ttl int64
+		switch l.opt.Algorithm {
+		case FixedWindow:
+			s, ttl, r = fixedWindow(s, now, l.opt.Limit, period, n)
+		case SlidingLog:
+			s, ttl, r = slidingLog(s, now, l.opt.Limit, period, n)
+		case SlidingWindow:
+			s, ttl, r = slidingWindow(s, now, l.opt.Limit, period, n)
+		case TokenBucket:
+			s, ttl, r = tokenBucket(s, now, l.opt.Limit, period, n, l.opt.Burst)
+		}
+		return formatState(s), time.Duration(ttl) * time.Millisecond, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
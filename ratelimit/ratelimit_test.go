@@ -0,0 +1,171 @@
+package ratelimit
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-baa/cache"
+	_ "github.com/go-baa/cache/memcache"
+	_ "github.com/go-baa/cache/redis"
+	_ "github.com/go-baa/cache/tiered"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// adapters the cachers limits are tested on, the lua scripts of redis
+// must give the same results as the algorithms in go
+var adapters = map[string]cache.Cacher{}
+
+func TestRateLimit(t *testing.T) {
+	for name, c := range adapters {
+		Convey("ratelimit "+name, t, func() {
+			// a clock in the window starting at base, keys of every run are new
+			base := time.Now().Truncate(time.Minute)
+			clock := base
+			prefix := "ratelimit:" + strconv.FormatInt(time.Now().UnixNano(), 36) + ":"
+			limiter := func(o Options) *Limiter {
+				l, err := New(c, o)
+				So(err, ShouldBeNil)
+				l.now = func() time.Time { return clock }
+				return l
+			}
+			at := func(d time.Duration) {
+				clock = base.Add(d)
+			}
+			allow := func(l *Limiter, key string, n int64, allowed bool, remaining int64, retry time.Duration) {
+				r, err := l.AllowN(prefix+key, n)
+				So(err, ShouldBeNil)
+				So(r.Allowed, ShouldEqual, allowed)
+				So(r.Remaining, ShouldEqual, remaining)
+				So(r.RetryAfter, ShouldEqual, retry)
+			}
+
+			Convey("fixed window", func() {
+				l := limiter(Options{Algorithm: FixedWindow, Limit: 3, Period: time.Minute})
+				at(time.Second)
+				allow(l, "fixed", 1, true, 2, 0)
+				allow(l, "fixed", 2, true, 0, 0)
+				allow(l, "fixed", 1, false, 0, time.Second*59)
+				allow(l, "fixed", 4, false, 0, -1)
+
+				at(time.Second * 61)
+				allow(l, "fixed", 1, true, 2, 0)
+				So(l.Reset(prefix+"fixed"), ShouldBeNil)
+				allow(l, "fixed", 3, true, 0, 0)
+			})
+
+			Convey("sliding log", func() {
+				l := limiter(Options{Algorithm: SlidingLog, Limit: 3, Period: time.Minute})
+				for i := 1; i <= 3; i++ {
+					at(time.Second * time.Duration(i))
+					allow(l, "log", 1, true, int64(3-i), 0)
+				}
+				at(time.Second * 4)
+				allow(l, "log", 1, false, 0, time.Second*57)
+
+				// the first request leaves the period
+				at(time.Second * 61)
+				allow(l, "log", 1, true, 0, 0)
+				at(time.Second * 62)
+				allow(l, "log", 2, false, 1, time.Second)
+				at(time.Second * 63)
+				allow(l, "log", 2, true, 0, 0)
+			})
+
+			Convey("sliding window", func() {
+				l := limiter(Options{Algorithm: SlidingWindow, Limit: 3, Period: time.Minute})
+				at(time.Second * 10)
+				allow(l, "window", 3, true, 0, 0)
+				allow(l, "window", 1, false, 0, time.Second*50+time.Millisecond)
+
+				// the previous window weights 3 * 30s / 60s = 1
+				at(time.Second * 90)
+				allow(l, "window", 1, true, 1, 0)
+				allow(l, "window", 1, true, 0, 0)
+				allow(l, "window", 1, false, 0, time.Second*10+time.Millisecond)
+				at(time.Second*100 + time.Millisecond)
+				allow(l, "window", 1, true, 0, 0)
+			})
+
+			Convey("token bucket", func() {
+				l := limiter(Options{Algorithm: TokenBucket, Limit: 3, Period: time.Minute})
+				at(0)
+				allow(l, "bucket", 3, true, 0, 0)
+				allow(l, "bucket", 1, false, 0, time.Second*20)
+				at(time.Second * 30)
+				allow(l, "bucket", 1, true, 0, 0)
+				allow(l, "bucket", 1, false, 0, time.Second*10)
+				at(time.Hour)
+				allow(l, "bucket", 1, true, 2, 0)
+
+				burst := limiter(Options{Algorithm: TokenBucket, Limit: 1, Period: time.Minute, Burst: 5})
+				allow(burst, "burst", 6, false, 0, -1)
+				allow(burst, "burst", 5, true, 0, 0)
+				allow(burst, "burst", 1, false, 0, time.Minute)
+			})
+
+			Convey("keys", func() {
+				l := limiter(Options{Algorithm: FixedWindow, Limit: 1, Period: time.Minute})
+				allow(l, "a", 1, true, 0, 0)
+				allow(l, "b", 1, true, 0, 0)
+				r, err := l.Allow(prefix + "a")
+				So(err, ShouldBeNil)
+				So(r.Allowed, ShouldBeFalse)
+				So(r.Limit, ShouldEqual, 1)
+			})
+		})
+	}
+}
+
+func TestRateLimitOptions(t *testing.T) {
+	Convey("ratelimit options", t, func() {
+		c := adapters["memory"]
+		_, err := New(c, Options{Limit: 0, Period: time.Second})
+		So(err, ShouldNotBeNil)
+		_, err = New(c, Options{Limit: 1})
+		So(err, ShouldNotBeNil)
+		_, err = New(c, Options{Limit: 1, Period: time.Second, Burst: -1})
+		So(err, ShouldNotBeNil)
+		_, err = New(c, Options{Algorithm: Algorithm(9), Limit: 1, Period: time.Second})
+		So(err, ShouldNotBeNil)
+		So(TokenBucket.String(), ShouldEqual, "token bucket")
+
+		l, err := New(c, Options{Limit: 1, Period: time.Second})
+		So(err, ShouldBeNil)
+		_, err = l.AllowN("negative", -1)
+		So(err, ShouldNotBeNil)
+
+		_, err = New(struct{ cache.Cacher }{c}, Options{Limit: 1, Period: time.Second})
+		So(err, ShouldEqual, cache.ErrNotSupported)
+	})
+}
+
+func init() {
+	adapters["memory"] = cache.New(cache.Options{
+		Name:    "testRateLimit",
+		Adapter: "memory",
+	})
+	adapters["tiered"] = cache.New(cache.Options{
+		Name:    "testRateLimitTiered",
+		Adapter: "tiered",
+		Config: map[string]interface{}{
+			"l2": adapters["memory"],
+		},
+	})
+	adapters["redis"] = cache.New(cache.Options{
+		Name:    "testRateLimitRedis",
+		Adapter: "redis",
+		Config: map[string]interface{}{
+			"host": "127.0.0.1",
+			"port": "6379",
+		},
+	})
+	adapters["memcache"] = cache.New(cache.Options{
+		Name:    "testRateLimitMemcache",
+		Adapter: "memcache",
+		Config: map[string]interface{}{
+			"host": "127.0.0.1",
+			"port": "11211",
+		},
+	})
+}
@@ -0,0 +1,100 @@
+package ratelimit
+
+// The lua scripts for Evaler stores, they match the algorithms in go.
+// Every script gets the time now, the limit, the period in milliseconds and
+// the requests to count, it returns allowed as 1 or 0, the remaining requests
+// and the milliseconds to retry after.
+
+// fixedWindowScript the count of the window is a counter
+const fixedWindowScript = `
+local now, limit, period, n = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+local count = tonumber(redis.call('GET', KEYS[1]) or '0')
+local reset = period - now % period
+if count + n > limit then
+	return {0, limit - count, reset}
+end
+count = redis.call('INCRBY', KEYS[1], n)
+redis.call('PEXPIRE', KEYS[1], reset)
+return {1, limit - count, 0}
+`
+
+// slidingLogScript the log is a sorted set of requests scored by time,
+// ARGV[5] is a unique id of the call for members
+const slidingLogScript = `
+local now, limit, period, n = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - period)
+local count = redis.call('ZCARD', KEYS[1])
+if count + n > limit then
+	local i = count + n - limit - 1
+	local t = redis.call('ZRANGE', KEYS[1], i, i, 'WITHSCORES')
+	return {0, limit - count, tonumber(t[2]) + period - now}
+end
+for i = 1, n do
+	redis.call('ZADD', KEYS[1], now, ARGV[5] .. ':' .. i)
+end
+redis.call('PEXPIRE', KEYS[1], period)
+return {1, limit - count - n, 0}
+`
+
+// slidingWindowScript the state is a hash of the window index w,
+// the counts of the previous window p and the current window c
+const slidingWindowScript = `
+local now, limit, period, n = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+local function decay(count, r)
+	if count <= r then
+		return 0
+	end
+	return math.max(period - math.floor(((r + 1) * period + count - 1) / count) + 1, 0)
+end
+local w = math.floor(now / period)
+local s = redis.call('HMGET', KEYS[1], 'w', 'p', 'c')
+local prev, cur = 0, 0
+if tonumber(s[1]) == w then
+	prev, cur = tonumber(s[2]), tonumber(s[3])
+elseif tonumber(s[1]) == w - 1 then
+	prev = tonumber(s[3])
+end
+local elapsed = now - w * period
+local weighted = math.floor(prev * (period - elapsed) / period)
+if weighted + cur + n > limit then
+	local retry
+	if limit - cur - n >= 0 then
+		retry = decay(prev, limit - cur - n) - elapsed
+	else
+		retry = period - elapsed + decay(cur, limit - n)
+	end
+	redis.call('HMSET', KEYS[1], 'w', w, 'p', prev, 'c', cur)
+	redis.call('PEXPIRE', KEYS[1], 2 * period - elapsed)
+	return {0, math.max(limit - weighted - cur, 0), retry}
+end
+cur = cur + n
+redis.call('HMSET', KEYS[1], 'w', w, 'p', prev, 'c', cur)
+redis.call('PEXPIRE', KEYS[1], 2 * period - elapsed)
+return {1, limit - weighted - cur, 0}
+`
+
+// tokenBucketScript the state is a hash of the tokens t and the time of the last update u,
+// ARGV[5] is the bucket size
+const tokenBucketScript = `
+local now, limit, period, n = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+local burst = tonumber(ARGV[5])
+local s = redis.call('HMGET', KEYS[1], 't', 'u')
+local tokens = burst
+if s[1] and s[2] then
+	tokens = tonumber(s[1])
+	local elapsed = now - tonumber(s[2])
+	if elapsed > 0 then
+		tokens = math.min(burst, tokens + elapsed * limit / period)
+	end
+end
+local allowed, retry = 0, 0
+if tokens < n then
+	retry = math.ceil((n - tokens) * period / limit)
+else
+	allowed = 1
+	tokens = tokens - n
+end
+redis.call('HMSET', KEYS[1], 't', string.format('%.17g', tokens), 'u', now)
+redis.call('PEXPIRE', KEYS[1], math.max(math.ceil((burst - tokens) * period / limit), 1))
+return {allowed, math.floor(tokens), retry}
+`
@@ -0,0 +1,132 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-baa/cache"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// busPingInterval is the interval to ping an idle subscription,
+	// a broken connection is found and reconnected by the ping
+	busPingInterval = 30 * time.Second
+	// busRetryInterval is the interval to retry after the subscription is broken
+	busRetryInterval = time.Second
+)
+
+// Bus implement an invalidation bus by redis pub/sub,
+// invalidations are published as json messages on a channel
+type Bus struct {
+	channel string
+	handle  redis.UniversalClient
+	pubsub  *redis.PubSub
+	mu      sync.RWMutex
+	subs    map[int]func(inv *cache.Invalidation)
+	next    int
+	exit    chan struct{}
+	done    chan struct{}
+}
+
+// NewBus create an invalidation bus on given channel by the client of redis cacher
+func NewBus(c *Redis, channel string) *Bus {
+	b := &Bus{
+		channel: channel,
+		handle:  c.handle,
+		pubsub:  c.handle.Subscribe(context.Background(), channel),
+		subs:    make(map[int]func(inv *cache.Invalidation)),
+		exit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go b.receive()
+	return b
+}
+
+// Publish sends invalidation to all subscribers of the channel
+func (b *Bus) Publish(inv *cache.Invalidation) error {
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	return b.handle.Publish(context.Background(), b.channel, data).Err()
+}
+
+// Subscribe registers fn to receive invalidations, returns a func to unsubscribe
+func (b *Bus) Subscribe(fn func(inv *cache.Invalidation)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.next
+	b.next++
+	b.subs[id] = fn
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs, id)
+	}
+}
+
+// Close unsubscribes the channel
+func (b *Bus) Close() error {
+	close(b.exit)
+	err := b.pubsub.Close()
+	<-b.done
+	return err
+}
+
+// receive delivers messages of the channel to subscribers until closed,
+// messages may be lost while the subscription is broken, so subscribers
+// are told to drop all local data after resubscribe
+func (b *Bus) receive() {
+	defer close(b.done)
+	ctx := context.Background()
+	var lost bool
+	for {
+		msg, err := b.pubsub.ReceiveTimeout(ctx, busPingInterval)
+		if err != nil {
+			select {
+			case <-b.exit:
+				return
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				// the reply of ping is received by the next receive
+				if err = b.pubsub.Ping(ctx); err == nil {
+					continue
+				}
+			}
+			lost = true
+			select {
+			case <-b.exit:
+				return
+			case <-time.After(busRetryInterval):
+			}
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			if m.Kind == "subscribe" && lost {
+				lost = false
+				b.deliver(&cache.Invalidation{All: true})
+			}
+		case *redis.Message:
+			inv := new(cache.Invalidation)
+			if err := json.Unmarshal([]byte(m.Payload), inv); err == nil {
+				b.deliver(inv)
+			}
+		}
+	}
+}
+
+// deliver calls all subscribers with invalidation
+func (b *Bus) deliver(inv *cache.Invalidation) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, fn := range b.subs {
+		fn(inv)
+	}
+}
@@ -0,0 +1,87 @@
+package redis
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-baa/cache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCacheRedisBus(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// two app instances, each has a redis client, a bus and a memory cache
+	newInstance := func() (cache.Cacher, *Bus) {
+		r := cache.New(cache.Options{
+			Name:    "testBus",
+			Adapter: "redis",
+			Config: map[string]interface{}{
+				"host": s.Host(),
+				"port": s.Port(),
+			},
+		})
+		bus := NewBus(r.(*Redis), "invalidate")
+		m := cache.New(cache.Options{
+			Name:    "testBus",
+			Adapter: "memory",
+			Prefix:  "app:",
+			Config: map[string]interface{}{
+				"bus": bus,
+			},
+		})
+		return m, bus
+	}
+
+	Convey("redis invalidation bus", t, func() {
+		m1, bus1 := newInstance()
+		defer bus1.Close()
+		m2, bus2 := newInstance()
+		defer bus2.Close()
+		So(eventually(func() bool { return s.PubSubNumSub("invalidate")["invalidate"] == 2 }), ShouldBeTrue)
+
+		Convey("delete evicts other instances", func() {
+			// the set of m1 evicts nothing, wait for it before m2 sets
+			var received int32
+			unsubscribe := bus2.Subscribe(func(inv *cache.Invalidation) { atomic.StoreInt32(&received, 1) })
+			m1.Set("key", "1", 10)
+			So(eventually(func() bool { return atomic.LoadInt32(&received) == 1 }), ShouldBeTrue)
+			unsubscribe()
+			m2.Set("key", "1", 10)
+			So(eventually(func() bool { return !m1.Exist("key") }), ShouldBeTrue)
+			So(m2.Exist("key"), ShouldBeTrue)
+
+			m2.(*cache.Memory).SetLocal("local", "1", 10)
+			So(m1.Delete("local"), ShouldBeNil)
+			So(eventually(func() bool { return !m2.Exist("local") }), ShouldBeTrue)
+
+			m2.(*cache.Memory).SetLocal("flush", "1", 10)
+			So(m1.Flush(), ShouldBeNil)
+			So(eventually(func() bool { return !m2.Exist("flush") }), ShouldBeTrue)
+		})
+
+		Convey("resubscribe drops local data", func() {
+			m2.(*cache.Memory).SetLocal("stale", "1", 10)
+			s.Close()
+			So(s.Restart(), ShouldBeNil)
+			So(eventually(func() bool { return !m2.Exist("stale") }), ShouldBeTrue)
+		})
+	})
+}
+
+// eventually returns true if fn returns true in 3 seconds
+func eventually(fn func() bool) bool {
+	for i := 0; i < 60; i++ {
+		if fn() {
+			return true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return false
+}
@@ -0,0 +1,26 @@
+package redis
+
+import (
+	"context"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// nodes returns the redis nodes to run node commands like SCAN,
+// every master node in cluster mode
+func (c *Redis) nodes(ctx context.Context) ([]redis.Cmdable, error) {
+	cc, ok := c.handle.(*redis.ClusterClient)
+	if !ok {
+		return []redis.Cmdable{c.handle}, nil
+	}
+	var mu sync.Mutex
+	var nodes []redis.Cmdable
+	err := cc.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		mu.Lock()
+		nodes = append(nodes, node)
+		mu.Unlock()
+		return nil
+	})
+	return nodes, err
+}
@@ -0,0 +1,89 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-baa/cache"
+	"github.com/redis/go-redis/v9"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCacheRedisClusterMode(t *testing.T) {
+	// miniredis answers CLUSTER SLOTS as a single master of all slots
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	Convey("redis cluster mode", t, func() {
+		c := cache.New(cache.Options{
+			Name:    "testCluster",
+			Adapter: "redis",
+			Prefix:  "cluster:",
+			Config: map[string]interface{}{
+				"clusterAddrs": s.Addr(),
+			},
+		})
+		_, ok := c.(*Redis).handle.(*redis.ClusterClient)
+		So(ok, ShouldBeTrue)
+		other := c.Namespace("other")
+
+		Convey("scan over masters", func() {
+			So(c.Set("a", "1", 10), ShouldBeNil)
+			So(c.Set("b", "1", 10), ShouldBeNil)
+			So(other.Set("a", "1", 10), ShouldBeNil)
+			keys, err := c.Keys("")
+			So(err, ShouldBeNil)
+			So(keys, ShouldHaveLength, 3)
+			So(keys, ShouldContain, "other:a")
+			keys, err = other.Keys("")
+			So(err, ShouldBeNil)
+			So(keys, ShouldResemble, []string{"a"})
+		})
+
+		Convey("keys in many slots are unlinked one by one", func() {
+			So(c.SetWithTags("a", "1", 10, "t"), ShouldBeNil)
+			So(c.SetWithTags("b", "1", 10, "t"), ShouldBeNil)
+			So(c.SetWithTags("c", "1", 10, "t", "u"), ShouldBeNil)
+			So(c.InvalidateTags("t"), ShouldBeNil)
+			So(c.Exist("a"), ShouldBeFalse)
+			So(c.Exist("b"), ShouldBeFalse)
+			So(c.Exist("c"), ShouldBeFalse)
+
+			So(c.SetWithTags("d", "1", 10, "u"), ShouldBeNil)
+			So(c.Delete("d"), ShouldBeNil)
+			So(c.Exist("d"), ShouldBeFalse)
+			So(s.Keys(), ShouldResemble, []string{"__tag:cluster:u"})
+		})
+
+		Convey("incr with ttl", func() {
+			n, err := c.IncrWithTTL("counter", 2, 10)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+			n, err = c.IncrWithTTL("counter", 3, 10)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 5)
+			So(s.TTL("cluster:counter").Seconds(), ShouldEqual, 10)
+		})
+
+		Convey("flush", func() {
+			So(c.Set("a", "1", 10), ShouldBeNil)
+			So(other.SetWithTags("a", "1", 10, "t"), ShouldBeNil)
+			s.Set("outside", "1")
+			So(other.Flush(), ShouldBeNil)
+			So(other.Exist("a"), ShouldBeFalse)
+			So(c.Exist("a"), ShouldBeTrue)
+			So(c.Flush(), ShouldBeNil)
+			So(s.Keys(), ShouldResemble, []string{"outside"})
+
+			So(c.FlushAll(), ShouldBeNil)
+			So(s.Keys(), ShouldBeEmpty)
+		})
+
+		Reset(func() {
+			s.FlushAll()
+		})
+	})
+}
@@ -0,0 +1,170 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-baa/cache"
+	"github.com/redis/go-redis/v9"
+)
+
+// config reads typed adapter config, keeps the first error
+type config struct {
+	m   map[string]interface{}
+	err error
+}
+
+func (p *config) string(key, def string) string {
+	if p.err != nil {
+		return def
+	}
+	var v string
+	v, p.err = cache.ConfigString(p.m, key, def)
+	return v
+}
+
+func (p *config) int(key string, def int) int {
+	if p.err != nil {
+		return def
+	}
+	var v int
+	v, p.err = cache.ConfigInt(p.m, key, def)
+	return v
+}
+
+func (p *config) int64(key string, def int64) int64 {
+	if p.err != nil {
+		return def
+	}
+	var v int64
+	v, p.err = cache.ConfigInt64(p.m, key, def)
+	return v
+}
+
+func (p *config) bool(key string, def bool) bool {
+	if p.err != nil {
+		return def
+	}
+	var v bool
+	v, p.err = cache.ConfigBool(p.m, key, def)
+	return v
+}
+
+func (p *config) list(key string, def []string) []string {
+	if p.err != nil {
+		return def
+	}
+	var v []string
+	v, p.err = cache.ConfigStrings(p.m, key, def)
+	return v
+}
+
+func (p *config) duration(key string, def time.Duration) time.Duration {
+	if p.err != nil {
+		return def
+	}
+	var v time.Duration
+	v, p.err = cache.ConfigDuration(p.m, key, def)
+	return v
+}
+
+// newClient creates a redis client by the adapter config,
+// a sentinel failover client if masterName is set,
+// a cluster client if clusterAddrs is set
+func newClient(m map[string]interface{}) (redis.UniversalClient, error) {
+	o, err := options(m)
+	if err != nil {
+		return nil, err
+	}
+	if o.MasterName != "" && len(o.Addrs) == 0 {
+		return nil, fmt.Errorf("redis: sentinelAddrs is required with masterName")
+	}
+	if o.IsClusterMode && o.DB != 0 {
+		return nil, fmt.Errorf("redis: cluster supports db 0 only")
+	}
+	return redis.NewUniversalClient(o), nil
+}
+
+// options parses the adapter config to redis client options
+func options(m map[string]interface{}) (*redis.UniversalOptions, error) {
+	p := &config{m: m}
+	o := &redis.UniversalOptions{
+		Addrs:           []string{net.JoinHostPort(p.string("host", "127.0.0.1"), strconv.Itoa(p.int("port", 6379)))},
+		Username:        p.string("username", ""),
+		Password:        p.string("password", ""),
+		DB:              p.int("db", 0),
+		Protocol:        p.int("protocol", 2),
+		PoolSize:        p.int("poolsize", 10),
+		MinIdleConns:    p.int("minIdleConns", 0),
+		MaxIdleConns:    p.int("maxIdleConns", 0),
+		MaxRetries:      p.int("maxRetries", 0),
+		DialTimeout:     p.duration("dialTimeout", 5*time.Second),
+		ReadTimeout:     p.duration("readTimeout", 0),
+		WriteTimeout:    p.duration("writeTimeout", 0),
+		PoolTimeout:     p.duration("poolTimeout", 0),
+		ConnMaxIdleTime: p.duration("idleTimeout", 0),
+		ConnMaxLifetime: p.duration("connMaxLifetime", 0),
+		MasterName:      p.string("masterName", ""),
+		DisableIdentity: true,
+	}
+	if socket := p.string("socket", ""); socket != "" {
+		// a unix socket path starts with "/", the client dials it by unix network
+		o.Addrs = []string{socket}
+	}
+	if o.MasterName != "" {
+		o.Addrs = p.list("sentinelAddrs", nil)
+	}
+	if clusterAddrs := p.list("clusterAddrs", nil); len(clusterAddrs) > 0 {
+		o.Addrs = clusterAddrs
+		o.IsClusterMode = true
+	}
+	o.TLSConfig = tlsConfig(p)
+	if p.err != nil {
+		return nil, p.err
+	}
+	return o, nil
+}
+
+// tlsConfig returns tls config if tls is enabled
+func tlsConfig(p *config) *tls.Config {
+	enabled := p.bool("tls", false)
+	caFile := p.string("tlsCAFile", "")
+	certFile := p.string("tlsCertFile", "")
+	keyFile := p.string("tlsKeyFile", "")
+	serverName := p.string("tlsServerName", "")
+	skipVerify := p.bool("tlsSkipVerify", false)
+	if p.err != nil || !enabled && caFile == "" && certFile == "" {
+		return nil
+	}
+
+	t := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: skipVerify,
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			p.err = fmt.Errorf("redis: read tls ca file: %v", err)
+			return nil
+		}
+		t.RootCAs = x509.NewCertPool()
+		if !t.RootCAs.AppendCertsFromPEM(pem) {
+			p.err = fmt.Errorf("redis: no certificate found in tls ca file %s", caFile)
+			return nil
+		}
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			p.err = fmt.Errorf("redis: load tls certificate: %v", err)
+			return nil
+		}
+		t.Certificates = []tls.Certificate{cert}
+	}
+	return t
+}
@@ -0,0 +1,132 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-baa/cache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCacheRedisOptions(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.RequireUserAuth("user", "pass")
+
+	Convey("redis options", t, func() {
+		Convey("username and db", func() {
+			c := new(Redis)
+			err := c.Start(cache.Options{
+				Name: "testOptions",
+				Config: map[string]interface{}{
+					"host":         s.Host(),
+					"port":         s.Port(),
+					"username":     "user",
+					"password":     "pass",
+					"db":           2,
+					"dialTimeout":  "1s",
+					"readTimeout":  "1s",
+					"writeTimeout": 1,
+					"idleTimeout":  "1m",
+				},
+			})
+			So(err, ShouldBeNil)
+			err = c.Set("test", 1, 10)
+			So(err, ShouldBeNil)
+			v, err := s.DB(2).Get("test")
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "1")
+		})
+
+		Convey("wrong password", func() {
+			c := new(Redis)
+			err := c.Start(cache.Options{
+				Name: "testOptions",
+				Config: map[string]interface{}{
+					"host":     s.Host(),
+					"port":     s.Port(),
+					"username": "user",
+					"password": "wrong",
+				},
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("invalid config", func() {
+			_, err := options(map[string]interface{}{
+				"port": true,
+			})
+			So(err, ShouldNotBeNil)
+			_, err = options(map[string]interface{}{
+				"readTimeout": "soon",
+			})
+			So(err, ShouldNotBeNil)
+			_, err = options(map[string]interface{}{
+				"tls":       true,
+				"tlsCAFile": "/not/exist/ca.pem",
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("jitter", func() {
+			c := new(Redis)
+			err := c.Start(cache.Options{
+				Name:       "testOptions",
+				Jitter:     50,
+				JitterSeed: 1,
+				Config: map[string]interface{}{
+					"host":     s.Host(),
+					"port":     s.Port(),
+					"username": "user",
+					"password": "pass",
+				},
+			})
+			So(err, ShouldBeNil)
+			for _, key := range []string{"a", "b", "c"} {
+				So(c.Set(key, "1", 100), ShouldBeNil)
+				So(s.TTL(key), ShouldBeBetweenOrEqual, 50*time.Second, 100*time.Second)
+				_, err = c.IncrWithTTL("counter:"+key, 1, 100)
+				So(err, ShouldBeNil)
+				So(s.TTL("counter:"+key), ShouldBeBetweenOrEqual, 50*time.Second, 100*time.Second)
+				_, err = c.SetNX("lock:"+key, "1", 100*time.Second)
+				So(err, ShouldBeNil)
+				So(s.TTL("lock:"+key), ShouldBeBetweenOrEqual, 50*time.Second, 100*time.Second)
+			}
+		})
+
+		Convey("socket", func() {
+			o, err := options(map[string]interface{}{
+				"socket": "/tmp/redis.sock",
+			})
+			So(err, ShouldBeNil)
+			So(o.Addrs, ShouldResemble, []string{"/tmp/redis.sock"})
+		})
+	})
+}
+
+func TestCacheRedisCluster(t *testing.T) {
+	Convey("redis sentinel and cluster config", t, func() {
+		_, err := newClient(map[string]interface{}{
+			"masterName": "mymaster",
+		})
+		So(err, ShouldNotBeNil)
+		_, err = newClient(map[string]interface{}{
+			"clusterAddrs": "127.0.0.1:7000,127.0.0.1:7001",
+			"db":           1,
+		})
+		So(err, ShouldNotBeNil)
+
+		o, err := options(map[string]interface{}{
+			"clusterAddrs": "127.0.0.1:7000,127.0.0.1:7001",
+			"tls":          true,
+		})
+		So(err, ShouldBeNil)
+		So(o.IsClusterMode, ShouldBeTrue)
+		So(o.Addrs, ShouldResemble, []string{"127.0.0.1:7000", "127.0.0.1:7001"})
+		So(o.TLSConfig, ShouldNotBeNil)
+	})
+}
@@ -1,18 +1,62 @@
 package redis
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/go-baa/cache"
-	"gopkg.in/redis.v3"
+	"github.com/redis/go-redis/v9"
 )
 
+// scanCount is the COUNT hint passed to each SCAN call,
+// also used as the batch size of deleting scanned keys
+const scanCount = 100
+
+// tagKeyPrefix is the key prefix, before cache prefix, of tag sets.
+// Tag sets are kept out of the keys under the cache prefix, so they never
+// collide with user keys, only keys of a cacher without prefix must not start with it.
+const tagKeyPrefix = "__tag:"
+
+// keyTagsPrefix is the key prefix, before cache prefix, of the tags of tagged keys,
+// a key is invalidated by a tag only if it is still tagged by the last write
+const keyTagsPrefix = "__keytags:"
+
+// incrScript increases a counter, sets expiry only if the counter is created
+var incrScript = redis.NewScript(`
+local created = redis.call('EXISTS', KEYS[1]) == 0
+local v = redis.call('INCRBY', KEYS[1], ARGV[1])
+if created then
+	redis.call('EXPIRE', KEYS[1], ARGV[2])
+end
+return v
+`)
+
+// compareAndDeleteScript deletes a key only if its value is ARGV[1]
+var compareAndDeleteScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// compareAndExpireScript sets ttl milliseconds of a key only if its value is ARGV[1]
+var compareAndExpireScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
 // Redis implement a redis cache adapter for cacher
 type Redis struct {
-	Name   string
-	Prefix string
-	handle *redis.Client
+	Name    string
+	Prefix  string
+	handle  redis.UniversalClient
+	tracker *tracker      // local copy of read keys, nil if client side caching is off
+	jitter  *cache.Jitter // jitter of ttl, nil if not set
 }
 
 // New create a cache instance of redis
@@ -22,8 +66,11 @@ func New() cache.Cacher {
 
 // Exist return true if value cached by given key
 func (c *Redis) Exist(key string) bool {
-	ok, err := c.handle.Exists(c.Prefix + key).Result()
-	if err == nil && ok {
+	if c.tracker != nil && c.tracker.exist(c.Prefix+key) {
+		return true
+	}
+	n, err := c.handle.Exists(context.Background(), c.Prefix+key).Result()
+	if err == nil && n > 0 {
 		return true
 	}
 	return false
@@ -31,15 +78,13 @@ func (c *Redis) Exist(key string) bool {
 
 // Get returns value by given key
 func (c *Redis) Get(key string, out interface{}) error {
-	v, err := c.handle.Get(c.Prefix + key).Bytes()
+	v, err := c.get(context.Background(), c.Prefix+key)
+	if err == redis.Nil {
+		return cache.MissError(err)
+	}
 	if err != nil {
 		return err
 	}
-
-	if cache.SimpleValue(v, out) {
-		return nil
-	}
-
 	item, err := cache.ItemBinary(v).Item()
 	if err != nil {
 		return err
@@ -47,23 +92,171 @@ func (c *Redis) Get(key string, out interface{}) error {
 	return item.Decode(out)
 }
 
+// GetWithTags returns value by given key like Get, and the tags associated with it
+func (c *Redis) GetWithTags(key string, out interface{}) ([]string, error) {
+	ctx := context.Background()
+	var get *redis.StringCmd
+	var tags *redis.StringSliceCmd
+	_, err := c.handle.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, c.Prefix+key)
+		tags = pipe.SMembers(ctx, keyTagsPrefix+c.Prefix+key)
+		return nil
+	})
+	if err == redis.Nil {
+		return nil, cache.MissError(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	item, err := cache.ItemBinary(get.Val()).Item()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(tags.Val())
+	return tags.Val(), item.Decode(out)
+}
+
 // Set cache value by given key, cache ttl second
 func (c *Redis) Set(key string, v interface{}, ttl int64) error {
-	if !cache.SimpleType(v) {
-		item := cache.NewItem(v, ttl)
-		b, err := item.Encode()
-		if err != nil {
-			return err
+	ttl = c.jitter.TTL(ttl)
+	b, err := value(v, ttl)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	defer c.forget(c.Prefix + key)
+	// the value is no longer tagged
+	_, err = c.handle.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, c.Prefix+key, b, time.Second*time.Duration(ttl))
+		pipe.Del(ctx, keyTagsPrefix+c.Prefix+key)
+		return nil
+	})
+	return err
+}
+
+// get returns stored value by given key with prefix,
+// from the local copy if client side caching is on
+func (c *Redis) get(ctx context.Context, key string) ([]byte, error) {
+	if c.tracker != nil {
+		return c.tracker.get(ctx, key)
+	}
+	return c.handle.Get(ctx, key).Bytes()
+}
+
+// forget drops local copies of given keys with prefix, the server
+// invalidates them too, but later than the write returns
+func (c *Redis) forget(keys ...string) {
+	if c.tracker != nil {
+		c.tracker.invalidate(keys...)
+	}
+}
+
+// SetWithTags cache value by given key like Set, and associates it with given tags,
+// every tag is a set of keys, it lives as long as its longest lived key
+func (c *Redis) SetWithTags(key string, v interface{}, ttl int64, tags ...string) error {
+	ttl = c.jitter.TTL(ttl)
+	b, err := value(v, ttl)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	defer c.forget(c.Prefix + key)
+	expiration := time.Second * time.Duration(ttl)
+	cards := make([]*redis.IntCmd, len(tags))
+	ttls := make([]*redis.DurationCmd, len(tags))
+	_, err = c.handle.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, c.Prefix+key, b, expiration)
+		keyTags := keyTagsPrefix + c.Prefix + key
+		pipe.Del(ctx, keyTags)
+		if len(tags) > 0 {
+			members := make([]interface{}, len(tags))
+			for i, tag := range tags {
+				members[i] = tag
+			}
+			pipe.SAdd(ctx, keyTags, members...)
+			if ttl > 0 {
+				pipe.Expire(ctx, keyTags, expiration)
+			}
+		}
+		for i, tag := range tags {
+			tagKey := c.tagKey(tag)
+			pipe.SAdd(ctx, tagKey, c.Prefix+key)
+			if ttl <= 0 {
+				pipe.Persist(ctx, tagKey)
+				continue
+			}
+			cards[i] = pipe.SCard(ctx, tagKey)
+			ttls[i] = pipe.TTL(ctx, tagKey)
 		}
-		v = []byte(b)
+		return nil
+	})
+	if err != nil || ttl <= 0 {
+		return err
+	}
+
+	// extends life time of a new tag set, or a tag set expires before key
+	_, err = c.handle.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, tag := range tags {
+			d := ttls[i].Val()
+			if cards[i].Val() == 1 || d >= 0 && d < expiration {
+				pipe.Expire(ctx, c.tagKey(tag), expiration)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// InvalidateTags delete all cached data associated with given tags,
+// a key set again by Set after SetWithTags is not associated with the old tags
+func (c *Redis) InvalidateTags(tags ...string) error {
+	ctx := context.Background()
+	members := make([]*redis.StringSliceCmd, len(tags))
+	_, err := c.handle.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, tag := range tags {
+			members[i] = pipe.SMembers(ctx, c.tagKey(tag))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// keys still tagged by their last write
+	tagged := make([][]*redis.BoolCmd, len(tags))
+	_, err = c.handle.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, tag := range tags {
+			for _, key := range members[i].Val() {
+				tagged[i] = append(tagged[i], pipe.SIsMember(ctx, keyTagsPrefix+key, tag))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	return c.handle.Set(c.Prefix+key, v, time.Second*time.Duration(ttl)).Err()
+	var keys []string
+	for i, tag := range tags {
+		for j, key := range members[i].Val() {
+			if tagged[i][j].Val() {
+				keys = append(keys, key, keyTagsPrefix+key)
+			}
+		}
+		keys = append(keys, c.tagKey(tag))
+	}
+	return c.unlink(ctx, keys)
+}
+
+// tagKey returns the key of the tag set
+func (c *Redis) tagKey(tag string) string {
+	return tagKeyPrefix + c.Prefix + tag
 }
 
 // Incr increases cached int-type value by given key as a counter
 // if key not exist, before increase set value with zero
 func (c *Redis) Incr(key string) (int64, error) {
-	t := c.handle.Incr(c.Prefix + key)
+	defer c.forget(c.Prefix + key)
+	t := c.handle.Incr(context.Background(), c.Prefix+key)
 	if t.Err() != nil {
 		return 0, t.Err()
 	}
@@ -73,58 +266,294 @@ func (c *Redis) Incr(key string) (int64, error) {
 // Decr decreases cached int-type value by given key as a counter
 // if key not exist, return errors
 func (c *Redis) Decr(key string) (int64, error) {
-	t := c.handle.Decr(c.Prefix + key)
+	defer c.forget(c.Prefix + key)
+	t := c.handle.Decr(context.Background(), c.Prefix+key)
 	if t.Err() != nil {
 		return 0, t.Err()
 	}
 	return t.Val(), nil
 }
 
+// IncrBy increases cached int-type value by given key with delta atomically,
+// if key not exist, before increase set value with zero
+func (c *Redis) IncrBy(key string, delta int64) (int64, error) {
+	defer c.forget(c.Prefix + key)
+	return c.handle.IncrBy(context.Background(), c.Prefix+key, delta).Result()
+}
+
+// IncrByFloat increases cached numeric value by given key with float delta atomically,
+// if key not exist, before increase set value with zero
+func (c *Redis) IncrByFloat(key string, delta float64) (float64, error) {
+	defer c.forget(c.Prefix + key)
+	return c.handle.IncrByFloat(context.Background(), c.Prefix+key, delta).Result()
+}
+
+// IncrWithTTL increases cached int-type value by given key with delta atomically,
+// if key not exist, the counter is created with ttl second by a lua script
+func (c *Redis) IncrWithTTL(key string, delta int64, ttl int64) (int64, error) {
+	if ttl <= 0 {
+		return c.IncrBy(key, delta)
+	}
+	ttl = c.jitter.TTL(ttl)
+	defer c.forget(c.Prefix + key)
+	return incrScript.Run(context.Background(), c.handle, []string{c.Prefix + key}, delta, ttl).Int64()
+}
+
+// SetNX cache value by given key only if the key does not exist by SET NX PX,
+// returns true if cached, the ttl is a duration for sub-second locks
+func (c *Redis) SetNX(key string, v string, ttl time.Duration) (bool, error) {
+	b, err := value(v, 0)
+	if err != nil {
+		return false, err
+	}
+	defer c.forget(c.Prefix + key)
+	return c.handle.SetNX(context.Background(), c.Prefix+key, b, c.jitter.Duration(ttl)).Result()
+}
+
+// CompareAndDelete delete cached data by given key only if its value is v
+// by a lua script, returns true if deleted
+func (c *Redis) CompareAndDelete(key string, v string) (bool, error) {
+	b, err := value(v, 0)
+	if err != nil {
+		return false, err
+	}
+	defer c.forget(c.Prefix + key)
+	n, err := compareAndDeleteScript.Run(context.Background(), c.handle, []string{c.Prefix + key}, b).Int64()
+	return n > 0, err
+}
+
+// CompareAndExpire sets ttl of cached data by given key only if its value is v
+// by a lua script, returns true if set
+func (c *Redis) CompareAndExpire(key string, v string, ttl time.Duration) (bool, error) {
+	b, err := value(v, 0)
+	if err != nil {
+		return false, err
+	}
+	n, err := compareAndExpireScript.Run(context.Background(), c.handle, []string{c.Prefix + key}, b, ttl.Milliseconds()).Int64()
+	return n > 0, err
+}
+
+// Eval runs a lua script with given keys under the cache prefix atomically,
+// the script is sent once and run by its sha later
+func (c *Redis) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	k := make([]string, len(keys))
+	for i, key := range keys {
+		k[i] = c.Prefix + key
+	}
+	defer c.forget(k...)
+	return redis.NewScript(script).Run(context.Background(), c.handle, k, args...).Result()
+}
+
 // Delete delete cached data by given key
 func (c *Redis) Delete(key string) error {
-	return c.handle.Del(c.Prefix + key).Err()
+	ctx := context.Background()
+	defer c.forget(c.Prefix + key)
+	_, err := c.handle.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, c.Prefix+key)
+		pipe.Del(ctx, keyTagsPrefix+c.Prefix+key)
+		return nil
+	})
+	return err
 }
 
-// Flush flush cacher
+// Flush delete all cached data and tags under the cache prefix,
+// keys are found by SCAN and removed by UNLINK in batches
 func (c *Redis) Flush() error {
-	return c.handle.FlushDb().Err()
+	ctx := context.Background()
+	var keys []string
+	for _, prefix := range []string{c.Prefix, tagKeyPrefix + c.Prefix, keyTagsPrefix + c.Prefix} {
+		err := c.scan(ctx, escapePattern(prefix)+"*", func(key string) error {
+			keys = append(keys, key)
+			if len(keys) >= scanCount {
+				err := c.unlink(ctx, keys)
+				keys = keys[:0]
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if c.Prefix == "" {
+			// all tags are scanned already
+			break
+		}
+	}
+	return c.unlink(ctx, keys)
+}
+
+// FlushAll delete all data of the current redis database,
+// in cluster mode, delete all data of every master node
+func (c *Redis) FlushAll() error {
+	ctx := context.Background()
+	if c.tracker != nil {
+		defer c.tracker.clear()
+	}
+	nodes, err := c.nodes(ctx)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if err = node.FlushDB(ctx).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unlink delete given keys by UNLINK, which reclaims memory in background,
+// falls back to DEL on redis server before 4.0.
+// In cluster mode, keys may be in different slots, each key is
+// unlinked by a command and the pipeline routes them to nodes.
+func (c *Redis) unlink(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	defer c.forget(keys...)
+	del := func(keys ...string) error {
+		_, err := c.handle.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			if _, ok := c.handle.(*redis.ClusterClient); !ok {
+				pipe.Unlink(ctx, keys...)
+				return nil
+			}
+			for _, key := range keys {
+				pipe.Unlink(ctx, key)
+			}
+			return nil
+		})
+		return err
+	}
+	err := del(keys...)
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "unknown command") {
+		return c.handle.Del(ctx, keys...).Err()
+	}
+	return err
+}
+
+// Scan calls fn for each cached key matching given glob pattern,
+// the iteration stops when fn returns an error.
+// It uses SCAN, so a key may be reported more than once
+// and keys changed during the iteration may be reported or not.
+func (c *Redis) Scan(pattern string, fn func(key string) error) error {
+	return c.scan(context.Background(), escapePattern(c.Prefix)+pattern, func(key string) error {
+		// tags are under the cache prefix only without prefix
+		if c.Prefix == "" && (strings.HasPrefix(key, tagKeyPrefix) || strings.HasPrefix(key, keyTagsPrefix)) {
+			return nil
+		}
+		return fn(strings.TrimPrefix(key, c.Prefix))
+	})
+}
+
+// scan calls fn for each redis key matching given pattern,
+// in cluster mode, scans every master node
+func (c *Redis) scan(ctx context.Context, match string, fn func(key string) error) error {
+	nodes, err := c.nodes(ctx)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if err = scanNode(ctx, node, match, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanNode calls fn for each key of the redis node matching given pattern
+func scanNode(ctx context.Context, node redis.Cmdable, match string, fn func(key string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := node.Scan(ctx, cursor, match, scanCount).Result()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err = fn(key); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// Keys returns cached keys which start with given prefix
+func (c *Redis) Keys(prefix string) ([]string, error) {
+	var keys []string
+	seen := make(map[string]bool)
+	err := c.Scan(escapePattern(prefix)+"*", func(key string) error {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// Jitter returns the jitter of ttl, nil if not set
+func (c *Redis) Jitter() *cache.Jitter {
+	return c.jitter
+}
+
+// Namespace returns a cacher under the namespace of given name,
+// it shares the redis connection pool with current cacher
+func (c *Redis) Namespace(name string) cache.Cacher {
+	return &Redis{
+		Name:    c.Name,
+		Prefix:  cache.NamespacePrefix(c.Prefix, name),
+		handle:  c.handle,
+		tracker: c.tracker,
+		jitter:  c.jitter,
+	}
 }
 
 // Start new a cacher and start service
 func (c *Redis) Start(o cache.Options) error {
 	c.Name = o.Name
 	c.Prefix = o.Prefix
-	var host, port, pass string
-	var poolSzie int
-	if val, ok := o.Config["host"]; ok {
-		host = val.(string)
-	} else {
-		host = "127.0.0.1"
-	}
-	if val, ok := o.Config["port"]; ok {
-		port = val.(string)
-	} else {
-		port = "6379"
-	}
-	if val, ok := o.Config["password"]; ok {
-		pass = val.(string)
-	}
-	if val, ok := o.Config["poolsize"]; ok {
-		poolSzie = val.(int)
-	} else {
-		poolSzie = 10
-	}
-	c.handle = redis.NewClient(&redis.Options{
-		Addr:     host + ":" + port,
-		Password: pass,
-		DB:       0,
-		PoolSize: poolSzie,
-	})
-	pong, err := c.handle.Ping().Result()
+	var err error
+	if c.jitter, err = cache.NewJitter(o); err != nil {
+		return err
+	}
+	c.handle, err = newClient(o.Config)
+	if err != nil {
+		return err
+	}
+	pong, err := c.handle.Ping(context.Background()).Result()
 	if err != nil || pong != "PONG" {
 		return fmt.Errorf("redis connect err: %s", err)
 	}
-	return nil
+	return c.startTracker(o.Config)
+}
+
+// Close stops client side caching and closes the connection pool,
+// which is shared by namespaces
+func (c *Redis) Close() error {
+	if c.tracker != nil {
+		c.tracker.close()
+	}
+	return c.handle.Close()
+}
+
+// value returns the stored value of v in the wire format shared by adapters
+func value(v interface{}, ttl int64) ([]byte, error) {
+	return cache.NewItem(v, ttl).Encode()
+}
+
+// escapePattern escapes the glob special characters of s for MATCH
+func escapePattern(s string) string {
+	var buf []byte
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\':
+			buf = append(buf, '\\')
+		}
+		buf = append(buf, s[i])
+	}
+	return string(buf)
 }
 
 func init() {
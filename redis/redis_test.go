@@ -1,7 +1,9 @@
 package redis
 
 import (
+	"context"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
@@ -25,6 +27,7 @@ func TestCacheRedis1(t *testing.T) {
 			var v string
 			c.Get("test", &v)
 			So(v, ShouldEqual, "1")
+			So(errors.Is(c.Get("notExist", &v), cache.ErrCacheMiss), ShouldBeTrue)
 		})
 
 		Convey("get gc", func() {
@@ -120,6 +123,270 @@ func TestCacheRedis1(t *testing.T) {
 	})
 }
 
+func TestCacheRedisScan(t *testing.T) {
+	Convey("cache redis scan", t, func() {
+		c.Set("scan:user:1", "a", 10)
+		c.Set("scan:user:2", "b", 10)
+		c.Set("scan:order:1", "c", 10)
+
+		Convey("scan", func() {
+			var keys []string
+			err := c.Scan("scan:user:*", func(key string) error {
+				keys = append(keys, key)
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(keys, ShouldHaveLength, 2)
+			So(keys, ShouldContain, "scan:user:1")
+			So(keys, ShouldContain, "scan:user:2")
+		})
+
+		Convey("keys", func() {
+			keys, err := c.Keys("scan:order:")
+			So(err, ShouldBeNil)
+			So(keys, ShouldResemble, []string{"scan:order:1"})
+		})
+
+		Convey("tag sets are not reported", func() {
+			c.SetWithTags("scan:tag:1", "a", 10, "scan")
+			c.Set("scan:tag:__tag:2", "b", 10)
+			keys, err := c.Keys("scan:tag:")
+			So(err, ShouldBeNil)
+			So(keys, ShouldHaveLength, 2)
+			So(keys, ShouldContain, "scan:tag:1")
+			So(keys, ShouldContain, "scan:tag:__tag:2")
+			keys, err = c.Keys(tagKeyPrefix)
+			So(err, ShouldBeNil)
+			So(keys, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestCacheRedisFlush(t *testing.T) {
+	Convey("cache redis flush by prefix", t, func() {
+		c1 := cache.New(cache.Options{
+			Name:    "testFlush1",
+			Adapter: "redis",
+			Prefix:  "flush1:",
+		})
+		c2 := cache.New(cache.Options{
+			Name:    "testFlush2",
+			Adapter: "redis",
+			Prefix:  "flush2:",
+		})
+		for i := 0; i < 250; i++ {
+			c1.Set(fmt.Sprintf("test%d", i), i, 10)
+		}
+		c2.Set("test", 1, 10)
+
+		err := c1.Flush()
+		So(err, ShouldBeNil)
+		keys, err := c1.Keys("")
+		So(err, ShouldBeNil)
+		So(keys, ShouldBeEmpty)
+		So(c2.Exist("test"), ShouldBeTrue)
+
+		err = c1.FlushAll()
+		So(err, ShouldBeNil)
+		So(c2.Exist("test"), ShouldBeFalse)
+	})
+}
+
+func TestCacheRedisTags(t *testing.T) {
+	Convey("cache redis tags", t, func() {
+		c.SetWithTags("user:1:page", "page", 10, "user:1")
+		c.SetWithTags("user:1:json", "json", 10, "user:1", "json")
+		c.SetWithTags("user:2:json", "json", 10, "user:2", "json")
+
+		var v string
+		err := c.Get("user:1:page", &v)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, "page")
+		tags, err := c.(*Redis).GetWithTags("user:1:json", &v)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, "json")
+		So(tags, ShouldResemble, []string{"json", "user:1"})
+
+		err = c.InvalidateTags("user:1")
+		So(err, ShouldBeNil)
+		So(c.Exist("user:1:page"), ShouldBeFalse)
+		So(c.Exist("user:1:json"), ShouldBeFalse)
+		So(c.Exist("user:2:json"), ShouldBeTrue)
+		_, err = c.(*Redis).GetWithTags("user:1:json", &v)
+		So(errors.Is(err, cache.ErrCacheMiss), ShouldBeTrue)
+
+		err = c.InvalidateTags("json")
+		So(err, ShouldBeNil)
+		So(c.Exist("user:2:json"), ShouldBeFalse)
+		// the tags of the last write are invalidated, like on memory
+		c.SetWithTags("user:3:page", "page", 10, "user:3")
+		c.Set("user:3:page", "plain", 10)
+		c.SetWithTags("user:3:json", "json", 10, "user:3")
+		c.SetWithTags("user:3:json", "json", 10, "json")
+		So(c.InvalidateTags("user:3"), ShouldBeNil)
+		So(c.Exist("user:3:page"), ShouldBeTrue)
+		So(c.Exist("user:3:json"), ShouldBeTrue)
+		So(c.InvalidateTags("json"), ShouldBeNil)
+		So(c.Exist("user:3:json"), ShouldBeFalse)
+		So(redisKeys(c, keyTagsPrefix+"user:3:*"), ShouldBeEmpty)
+		c.Delete("user:3:page")
+	})
+}
+
+func TestCacheRedisNamespace(t *testing.T) {
+	Convey("cache redis namespace", t, func() {
+		app := cache.New(cache.Options{
+			Name:    "testNamespace",
+			Adapter: "redis",
+			Prefix:  "app:",
+		})
+		orders := app.Namespace("orders")
+		users := app.Namespace("users")
+		orders.Set("1", "order", 10)
+		users.Set("1", "user", 10)
+		app.Set("1", "app", 10)
+
+		var v string
+		orders.Get("1", &v)
+		So(v, ShouldEqual, "order")
+		users.Get("1", &v)
+		So(v, ShouldEqual, "user")
+
+		err := orders.Flush()
+		So(err, ShouldBeNil)
+		So(orders.Exist("1"), ShouldBeFalse)
+		So(users.Exist("1"), ShouldBeTrue)
+		So(app.Exist("1"), ShouldBeTrue)
+
+		// tag sets of namespaces are not keys of the parent,
+		// user keys like tag sets are
+		So(orders.SetWithTags("2", "order", 10, "t"), ShouldBeNil)
+		So(app.Set("__tag:1", "app", 10), ShouldBeNil)
+		keys, err := app.Keys("")
+		So(err, ShouldBeNil)
+		So(keys, ShouldHaveLength, 4)
+		So(keys, ShouldContain, "orders:2")
+		So(keys, ShouldContain, "__tag:1")
+		So(orders.InvalidateTags("t"), ShouldBeNil)
+		So(orders.Exist("2"), ShouldBeFalse)
+		So(app.Exist("__tag:1"), ShouldBeTrue)
+
+		So(orders.SetWithTags("2", "order", 10, "t"), ShouldBeNil)
+		err = app.Flush()
+		So(err, ShouldBeNil)
+		So(users.Exist("1"), ShouldBeFalse)
+		So(redisKeys(app, "__tag:app:*"), ShouldBeEmpty)
+	})
+}
+
+// redisKeys returns the redis keys matching pattern, out of the cache prefix
+func redisKeys(c cache.Cacher, pattern string) []string {
+	keys, _ := c.(*Redis).handle.Keys(context.Background(), pattern).Result()
+	return keys
+}
+
+func TestCacheRedisIncr(t *testing.T) {
+	Convey("cache redis atomic incr", t, func() {
+		c.Delete("counter")
+		c.Delete("float")
+
+		v, err := c.IncrBy("counter", 5)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, 5)
+		v, err = c.IncrBy("counter", -7)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, -2)
+
+		f, err := c.IncrByFloat("float", 1.5)
+		So(err, ShouldBeNil)
+		So(f, ShouldEqual, 1.5)
+		f, err = c.IncrByFloat("counter", 0.5)
+		So(err, ShouldBeNil)
+		So(f, ShouldEqual, -1.5)
+
+		v, err = c.IncrWithTTL("ttl", 1, 1)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, 1)
+		v, err = c.IncrWithTTL("ttl", 1, 10)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, 2)
+		time.Sleep(time.Millisecond * 1500)
+		So(c.Exist("ttl"), ShouldBeFalse)
+	})
+}
+
+func TestCacheRedisLock(t *testing.T) {
+	Convey("cache redis lock", t, func() {
+		store := c.(interface {
+			SetNX(key string, v string, ttl time.Duration) (bool, error)
+			CompareAndDelete(key string, v string) (bool, error)
+			CompareAndExpire(key string, v string, ttl time.Duration) (bool, error)
+		})
+		c.Delete("lock")
+
+		ok, err := store.SetNX("lock", "a", time.Second)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		ok, err = store.SetNX("lock", "b", time.Second)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+
+		ok, err = store.CompareAndExpire("lock", "b", time.Second*10)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+		ok, err = store.CompareAndExpire("lock", "a", time.Second*10)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		time.Sleep(time.Millisecond * 1500)
+		So(c.Exist("lock"), ShouldBeTrue)
+
+		ok, err = store.CompareAndDelete("lock", "b")
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+		ok, err = store.CompareAndDelete("lock", "a")
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		So(c.Exist("lock"), ShouldBeFalse)
+
+		ok, err = store.CompareAndDelete("lock", "a")
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+		ok, err = store.CompareAndExpire("lock", "a", time.Second)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestCacheRedisEncoding(t *testing.T) {
+	Convey("cache redis encoding", t, func() {
+		now := time.Now()
+		c.Set("time", now, 10)
+		c.Set("duration", time.Minute, 10)
+		c.Set("bytes", []byte("raw"), 10)
+		c.Set("string", "abc", 10)
+
+		var tm time.Time
+		err := c.Get("time", &tm)
+		So(err, ShouldBeNil)
+		So(tm.Equal(now), ShouldBeTrue)
+		var d time.Duration
+		err = c.Get("duration", &d)
+		So(err, ShouldBeNil)
+		So(d, ShouldEqual, time.Minute)
+		var b []byte
+		err = c.Get("bytes", &b)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, "raw")
+
+		var n int
+		err = c.Get("string", &n)
+		So(err, ShouldNotBeNil)
+		v, err := c.IncrBy("duration", 1)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, int64(time.Minute)+1)
+	})
+}
+
 func BenchmarkCacheRedisSet(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		c.Set(fmt.Sprintf("test%d", i), 1, 1800)
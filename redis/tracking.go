@@ -0,0 +1,326 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-baa/cache/lru"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultClientCacheSize is the default maximum number of keys kept by client side caching
+const DefaultClientCacheSize = 10000
+
+// invalidateChannel is the channel redis sends invalidation messages on
+const invalidateChannel = "__redis__:invalidate"
+
+// tracker keeps a bounded local copy of read keys by redis server-assisted
+// client side caching. Keys are read by reader connections which turn on
+// CLIENT TRACKING with REDIRECT, redis sends messages of changed keys to
+// a dedicated subscriber connection, so it works with both RESP2 and RESP3.
+type tracker struct {
+	opt    redis.UniversalOptions
+	bcast  bool
+	prefix string
+	handle redis.Cmdable // reads go to handle while the local copy is off
+	inv    *redis.Client // client of the subscriber connection
+	pubsub *redis.PubSub
+	id     int64 // client id of the subscriber connection
+
+	mu      sync.Mutex
+	store   *lru.Cache
+	reader  *redis.Client // nil if invalidations may be lost
+	pending map[string]int64
+	seq     int64
+
+	exit      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// trackedEntry a local copy of stored value
+type trackedEntry struct {
+	data       []byte
+	expiration int64 // unix nano, 0 for no expiration
+}
+
+// startTracker turns on client side caching by config clientCache
+func (c *Redis) startTracker(m map[string]interface{}) error {
+	p := &config{m: m}
+	enabled := p.bool("clientCache", false)
+	size := p.int("clientCacheSize", DefaultClientCacheSize)
+	mode := p.string("clientCacheMode", "default")
+	if p.err != nil || !enabled {
+		return p.err
+	}
+	if mode != "default" && mode != "bcast" {
+		return fmt.Errorf("redis: clientCacheMode expects default or bcast, got %s", mode)
+	}
+	o, err := options(m)
+	if err != nil {
+		return err
+	}
+	if o.IsClusterMode {
+		return fmt.Errorf("redis: clientCache is not supported in cluster mode")
+	}
+	c.tracker, err = newTracker(c.handle, o, c.Prefix, size, mode == "bcast")
+	return err
+}
+
+// newTracker subscribes the invalidation channel and creates the reader,
+// returns an error if the server does not support client tracking
+func newTracker(handle redis.Cmdable, o *redis.UniversalOptions, prefix string, size int, bcast bool) (*tracker, error) {
+	t := &tracker{
+		opt:     *o,
+		bcast:   bcast,
+		prefix:  prefix,
+		handle:  handle,
+		store:   lru.New(size),
+		pending: make(map[string]int64),
+		exit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	t.inv = t.client(func(ctx context.Context, cn *redis.Conn) error {
+		id, err := cn.ClientID(ctx).Result()
+		if err != nil {
+			return err
+		}
+		atomic.StoreInt64(&t.id, id)
+		return nil
+	})
+
+	ctx := context.Background()
+	if o.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.DialTimeout)
+		defer cancel()
+	}
+	t.pubsub = t.inv.Subscribe(ctx, invalidateChannel)
+	if _, err := t.pubsub.Receive(ctx); err != nil {
+		t.pubsub.Close()
+		t.inv.Close()
+		return nil, fmt.Errorf("redis: subscribe invalidation: %v", err)
+	}
+	reader := t.newReader()
+	if err := reader.Ping(ctx).Err(); err != nil {
+		reader.Close()
+		t.pubsub.Close()
+		t.inv.Close()
+		return nil, fmt.Errorf("redis: client tracking: %v", err)
+	}
+	t.reader = reader
+	go t.receive()
+	return t, nil
+}
+
+// client creates a non-cluster client with the connect hook
+func (t *tracker) client(onConnect func(ctx context.Context, cn *redis.Conn) error) *redis.Client {
+	o := t.opt
+	o.OnConnect = onConnect
+	if o.MasterName != "" {
+		return redis.NewFailoverClient(o.Failover())
+	}
+	return redis.NewClient(o.Simple())
+}
+
+// newReader creates a client whose connections redirect tracking
+// messages to current subscriber connection
+func (t *tracker) newReader() *redis.Client {
+	args := []interface{}{"CLIENT", "TRACKING", "ON", "REDIRECT", atomic.LoadInt64(&t.id)}
+	if t.bcast {
+		args = append(args, "BCAST")
+		if t.prefix != "" {
+			args = append(args, "PREFIX", t.prefix)
+		}
+	}
+	return t.client(func(ctx context.Context, cn *redis.Conn) error {
+		return cn.Do(ctx, args...).Err()
+	})
+}
+
+// exist returns true if key has a local copy
+func (t *tracker) exist(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.local(key) != nil
+}
+
+// get returns stored value of key from the local copy,
+// or reads it from redis and keeps a local copy
+func (t *tracker) get(ctx context.Context, key string) ([]byte, error) {
+	t.mu.Lock()
+	if e := t.local(key); e != nil {
+		t.mu.Unlock()
+		return e.data, nil
+	}
+	reader := t.reader
+	if reader == nil {
+		t.mu.Unlock()
+		return t.handle.Get(ctx, key).Bytes()
+	}
+	// an invalidation of key during the read drops the pending mark,
+	// then the value read may be stale and is not kept
+	t.seq++
+	seq := t.seq
+	t.pending[key] = seq
+	t.mu.Unlock()
+
+	var get *redis.StringCmd
+	var pttl *redis.DurationCmd
+	_, err := reader.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		pttl = pipe.PTTL(ctx, key)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		t.mu.Lock()
+		delete(t.pending, key)
+		t.mu.Unlock()
+		return t.handle.Get(ctx, key).Bytes()
+	}
+	data, err := get.Bytes()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pending[key] != seq {
+		return data, err
+	}
+	delete(t.pending, key)
+	if err != nil {
+		return nil, err
+	}
+	e := &trackedEntry{data: data}
+	switch d := pttl.Val(); {
+	case d > 0:
+		e.expiration = time.Now().Add(d).UnixNano()
+	case d != -1:
+		// expired right after the read
+		return data, nil
+	}
+	t.store.Add(key, e)
+	return data, nil
+}
+
+// local returns the unexpired local copy of key, must be called with lock held
+func (t *tracker) local(key string) *trackedEntry {
+	v, ok := t.store.Get(key)
+	if !ok {
+		return nil
+	}
+	e := v.(*trackedEntry)
+	if e.expiration > 0 && e.expiration <= time.Now().UnixNano() {
+		t.store.Remove(key)
+		return nil
+	}
+	return e
+}
+
+// invalidate drops local copies of keys
+func (t *tracker) invalidate(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, key := range keys {
+		t.store.Remove(key)
+		delete(t.pending, key)
+	}
+}
+
+// clear drops all local copies
+func (t *tracker) clear() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.store.Clear()
+	t.pending = make(map[string]int64)
+}
+
+// disable drops all local copies and stops keeping new ones,
+// until the subscription is recovered
+func (t *tracker) disable() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.store.Clear()
+	t.pending = make(map[string]int64)
+	if t.reader != nil {
+		t.reader.Close()
+		t.reader = nil
+	}
+}
+
+// reset drops all local copies and creates a reader redirecting to current
+// subscriber connection, reader connections of the old one may redirect
+// to a closed connection
+func (t *tracker) reset() {
+	reader := t.newReader()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.store.Clear()
+	t.pending = make(map[string]int64)
+	if t.reader != nil {
+		t.reader.Close()
+	}
+	t.reader = reader
+}
+
+// receive drops local copies by invalidation messages until closed
+func (t *tracker) receive() {
+	defer close(t.done)
+	ctx := context.Background()
+	var lost bool
+	for {
+		msg, err := t.pubsub.ReceiveTimeout(ctx, busPingInterval)
+		if err != nil {
+			select {
+			case <-t.exit:
+				return
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				if err = t.pubsub.Ping(ctx); err == nil {
+					continue
+				}
+			}
+			// a flush is sent as a message without keys which fails to parse,
+			// other errors break the subscription, the ping reconnects it
+			// and the reply of ping or resubscribe recovers the local copy
+			t.disable()
+			lost = true
+			if err = t.pubsub.Ping(ctx); err == nil {
+				continue
+			}
+			select {
+			case <-t.exit:
+				return
+			case <-time.After(busRetryInterval):
+			}
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *redis.Subscription, *redis.Pong:
+			if lost {
+				lost = false
+				t.reset()
+			}
+		case *redis.Message:
+			if m.Payload != "" {
+				t.invalidate(m.Payload)
+			}
+			t.invalidate(m.PayloadSlice...)
+		}
+	}
+}
+
+// close stops the subscription and closes the clients
+func (t *tracker) close() {
+	t.closeOnce.Do(func() {
+		close(t.exit)
+		t.pubsub.Close()
+		<-t.done
+		t.disable()
+		t.inv.Close()
+	})
+}
@@ -0,0 +1,234 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-baa/cache"
+	"github.com/go-baa/cache/lru"
+	"github.com/redis/go-redis/v9"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCacheRedisClientCache(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	Convey("redis client side caching", t, func() {
+		Convey("config", func() {
+			c := new(Redis)
+			err := c.Start(cache.Options{
+				Config: map[string]interface{}{
+					"host":            s.Host(),
+					"port":            s.Port(),
+					"clientCache":     true,
+					"clientCacheMode": "optin",
+				},
+			})
+			So(err, ShouldNotBeNil)
+
+			// miniredis does not support client tracking
+			c = new(Redis)
+			err = c.Start(cache.Options{
+				Config: map[string]interface{}{
+					"host":        s.Host(),
+					"port":        s.Port(),
+					"clientCache": true,
+				},
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("local copy", func() {
+			ctx := context.Background()
+			handle := redis.NewClient(&redis.Options{Addr: s.Addr()})
+			defer handle.Close()
+			tr := &tracker{
+				handle:  handle,
+				store:   lru.New(2),
+				pending: make(map[string]int64),
+				reader:  redis.NewClient(&redis.Options{Addr: s.Addr()}),
+			}
+			defer tr.disable()
+
+			s.Set("a", "1")
+			v, err := tr.get(ctx, "a")
+			So(err, ShouldBeNil)
+			So(string(v), ShouldEqual, "1")
+			So(tr.exist("a"), ShouldBeTrue)
+
+			// served locally until invalidated
+			s.Set("a", "2")
+			v, _ = tr.get(ctx, "a")
+			So(string(v), ShouldEqual, "1")
+			tr.invalidate("a")
+			v, _ = tr.get(ctx, "a")
+			So(string(v), ShouldEqual, "2")
+
+			_, err = tr.get(ctx, "notExist")
+			So(err, ShouldEqual, redis.Nil)
+			So(tr.exist("notExist"), ShouldBeFalse)
+
+			// bounded by size
+			s.Set("b", "1")
+			s.Set("c", "1")
+			tr.get(ctx, "b")
+			tr.get(ctx, "c")
+			So(tr.store.Len(), ShouldEqual, 2)
+			So(tr.exist("a"), ShouldBeFalse)
+
+			// expires with the key
+			s.Set("d", "1")
+			s.SetTTL("d", time.Millisecond*100)
+			tr.get(ctx, "d")
+			So(tr.exist("d"), ShouldBeTrue)
+			time.Sleep(time.Millisecond * 150)
+			So(tr.exist("d"), ShouldBeFalse)
+
+			// reads go to redis while the local copy is off
+			tr.disable()
+			So(tr.store.Len(), ShouldEqual, 0)
+			v, err = tr.get(ctx, "b")
+			So(err, ShouldBeNil)
+			So(string(v), ShouldEqual, "1")
+			So(tr.exist("b"), ShouldBeFalse)
+		})
+
+		Convey("invalidated during read", func() {
+			ctx := context.Background()
+			reader := redis.NewClient(&redis.Options{Addr: s.Addr()})
+			tr := &tracker{
+				store:   lru.New(0),
+				pending: make(map[string]int64),
+				reader:  reader,
+			}
+			defer tr.disable()
+			reader.AddHook(invalidateHook{tr, "a"})
+
+			s.Set("a", "1")
+			v, err := tr.get(ctx, "a")
+			So(err, ShouldBeNil)
+			So(string(v), ShouldEqual, "1")
+			So(tr.exist("a"), ShouldBeFalse)
+		})
+	})
+}
+
+// invalidateHook invalidates key of tracker before the pipeline is sent
+type invalidateHook struct {
+	t   *tracker
+	key string
+}
+
+func (h invalidateHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h invalidateHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (h invalidateHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		h.t.invalidate(h.key)
+		return next(ctx, cmds)
+	}
+}
+
+func TestCacheRedisClientCacheServer(t *testing.T) {
+	// client tracking needs redis 6 or later, the test server of the suite,
+	// the test is skipped without it unless CACHE_TEST_REDIS_TRACKING is set, like on CI
+	c := new(Redis)
+	err := c.Start(cache.Options{
+		Name:   "testTracking",
+		Prefix: "tracking:",
+		Config: map[string]interface{}{
+			"host":        "127.0.0.1",
+			"port":        "6379",
+			"db":          9,
+			"clientCache": true,
+		},
+	})
+	if err != nil && os.Getenv("CACHE_TEST_REDIS_TRACKING") != "" {
+		t.Fatalf("redis with client tracking is required: %v", err)
+	}
+	if err != nil {
+		t.Skipf("redis with client tracking is not available: %v", err)
+	}
+	defer c.Close()
+	tr := c.tracker
+	ctx := context.Background()
+	other := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379", DB: 9})
+	defer other.Close()
+
+	// cached returns true if key is read into the local copy
+	cached := func(key, want string) bool {
+		var v string
+		return c.Get(key, &v) == nil && v == want && tr.exist(c.Prefix+key)
+	}
+	// redirected returns true if the reader redirects to current subscriber connection
+	redirected := func() bool {
+		tr.mu.Lock()
+		reader := tr.reader
+		tr.mu.Unlock()
+		if reader == nil {
+			return false
+		}
+		id, err := reader.Do(ctx, "CLIENT", "GETREDIR").Int64()
+		return err == nil && id == atomic.LoadInt64(&tr.id)
+	}
+
+	Convey("redis client side caching by server", t, func() {
+		So(redirected(), ShouldBeTrue)
+
+		Convey("write of other client evicts the local copy", func() {
+			So(c.Set("key", "1", 10), ShouldBeNil)
+			So(cached("key", "1"), ShouldBeTrue)
+			b, _ := value("2", 10)
+			So(other.Set(ctx, c.Prefix+"key", b, 10*time.Second).Err(), ShouldBeNil)
+			So(eventually(func() bool { return !tr.exist(c.Prefix + "key") }), ShouldBeTrue)
+			So(cached("key", "2"), ShouldBeTrue)
+
+			So(other.Del(ctx, c.Prefix+"key").Err(), ShouldBeNil)
+			So(eventually(func() bool { return !tr.exist(c.Prefix + "key") }), ShouldBeTrue)
+		})
+
+		Convey("flush drops all local copies", func() {
+			So(c.Set("a", "1", 10), ShouldBeNil)
+			So(c.Set("b", "1", 10), ShouldBeNil)
+			So(cached("a", "1"), ShouldBeTrue)
+			So(cached("b", "1"), ShouldBeTrue)
+			// the server sends a message with a null payload
+			So(other.FlushDB(ctx).Err(), ShouldBeNil)
+			So(eventually(func() bool { return !tr.exist(c.Prefix+"a") && !tr.exist(c.Prefix+"b") }), ShouldBeTrue)
+
+			So(c.Set("a", "2", 10), ShouldBeNil)
+			So(eventually(func() bool { return cached("a", "2") }), ShouldBeTrue)
+			So(eventually(redirected), ShouldBeTrue)
+		})
+
+		Convey("reconnect resets the reader", func() {
+			So(c.Set("key", "1", 10), ShouldBeNil)
+			So(cached("key", "1"), ShouldBeTrue)
+			id := atomic.LoadInt64(&tr.id)
+			So(other.ClientKillByFilter(ctx, "ID", fmt.Sprint(id)).Err(), ShouldBeNil)
+			So(eventually(func() bool { return atomic.LoadInt64(&tr.id) != id }), ShouldBeTrue)
+			So(eventually(redirected), ShouldBeTrue)
+			So(tr.exist(c.Prefix+"key"), ShouldBeFalse)
+
+			// invalidations reach the new subscriber connection
+			So(cached("key", "1"), ShouldBeTrue)
+			b, _ := value("2", 10)
+			So(other.Set(ctx, c.Prefix+"key", b, 10*time.Second).Err(), ShouldBeNil)
+			So(eventually(func() bool { return !tr.exist(c.Prefix + "key") }), ShouldBeTrue)
+		})
+	})
+}
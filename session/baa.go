@@ -0,0 +1,32 @@
+package session
+
+import (
+	"github.com/go-baa/baa"
+)
+
+// ContextKey is the key of the session in baa.Context
+const ContextKey = "session"
+
+// Middleware returns a baa middleware starting the session of every request,
+// get the session in handlers by FromContext, it is saved after the handlers
+// if it is changed
+func Middleware(m *Manager) baa.HandlerFunc {
+	return func(c *baa.Context) {
+		s, err := m.Start(c.Resp, c.Req)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.Set(ContextKey, s)
+		c.Next()
+		if err = s.Save(); err != nil {
+			c.Baa().Logger().Printf("session: save failed: %v\n", err)
+		}
+	}
+}
+
+// FromContext returns the session started by the middleware, nil if not started
+func FromContext(c *baa.Context) *Session {
+	s, _ := c.Get(ContextKey).(*Session)
+	return s
+}
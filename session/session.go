@@ -0,0 +1,300 @@
+// Package session providers a session manager for baa built on cacher,
+// any adapter can store sessions.
+package session
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-baa/cache"
+)
+
+const (
+	// DefaultCookieName is the default name of the session cookie
+	DefaultCookieName = "BAASESSID"
+	// DefaultMaxAge is the default life time of an idle session
+	DefaultMaxAge = 30 * time.Minute
+	// idBytes is the random bytes of a session id
+	idBytes = 32
+)
+
+// Options session manager options
+type Options struct {
+	CookieName string        // name of the session cookie, default BAASESSID
+	Path       string        // path of the session cookie, default /
+	Domain     string        // domain of the session cookie
+	Secure     bool          // send the session cookie over https only
+	SameSite   http.SameSite // same site mode of the session cookie
+	MaxAge     time.Duration // life time of an idle session, renewed by requests, default 30m
+	Persistent bool          // the cookie lives for MaxAge, or until the browser is closed
+}
+
+// Manager creates and loads sessions stored in a cacher,
+// the session cookie is always http only
+type Manager struct {
+	c   cache.Cacher
+	opt Options
+}
+
+// New create a session manager storing sessions in c,
+// use a namespace of the cacher to keep session keys apart
+func New(c cache.Cacher, o Options) *Manager {
+	if o.CookieName == "" {
+		o.CookieName = DefaultCookieName
+	}
+	if o.Path == "" {
+		o.Path = "/"
+	}
+	if o.MaxAge <= 0 {
+		o.MaxAge = DefaultMaxAge
+	}
+	return &Manager{c: c, opt: o}
+}
+
+// Start loads the session of the request by its cookie, or creates a new one.
+// An unknown session id from the client is never used, a new id is created for it.
+// A new session is stored and its cookie is written only after it is changed by
+// Set, SetFlash or Regenerate, so a request without a session costs nothing.
+// The cookie is written to w, so it must be called before the response is written.
+func (m *Manager) Start(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	s := &Session{m: m, w: w}
+	if cookie, err := r.Cookie(m.opt.CookieName); err == nil && validID(cookie.Value) {
+		var rec record
+		if err = m.c.Get(cookie.Value, &rec); err == nil {
+			s.id = cookie.Value
+			s.rec = rec
+			s.stored = true
+			// sliding expiration, renew the session when half of its life is gone
+			if time.Until(time.Unix(0, rec.Expiration)) < m.opt.MaxAge/2 {
+				s.dirty = true
+				m.setCookie(w, s.id, m.opt.MaxAge)
+			}
+			return s, nil
+		}
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	s.id = id
+	s.isNew = true
+	return s, nil
+}
+
+// setCookie writes the session cookie of id, a negative age deletes it
+func (m *Manager) setCookie(w http.ResponseWriter, id string, age time.Duration) {
+	cookie := &http.Cookie{
+		Name:     m.opt.CookieName,
+		Value:    id,
+		Path:     m.opt.Path,
+		Domain:   m.opt.Domain,
+		Secure:   m.opt.Secure,
+		HttpOnly: true,
+		SameSite: m.opt.SameSite,
+	}
+	if age < 0 {
+		cookie.MaxAge = -1
+		cookie.Expires = time.Unix(1, 0)
+	} else if m.opt.Persistent {
+		cookie.MaxAge = int((age + time.Second - 1) / time.Second)
+		cookie.Expires = time.Now().Add(age)
+	}
+	http.SetCookie(w, cookie)
+}
+
+// Session the data of a client kept between requests
+type Session struct {
+	m         *Manager
+	w         http.ResponseWriter
+	mu        sync.Mutex
+	id        string
+	rec       record
+	isNew     bool
+	stored    bool // the session is in the cacher
+	dirty     bool
+	cookie    bool // the cookie of a new session is written
+	destroyed bool
+}
+
+// record the stored data of a session
+type record struct {
+	Values     map[string]interface{}
+	Flashes    map[string]interface{}
+	Expiration int64 // expired time in unix nano
+}
+
+// ID returns the session id
+func (s *Session) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
+
+// IsNew returns true if the session is created by this request
+func (s *Session) IsNew() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.isNew
+}
+
+// Get returns the value by given key, nil if not exist
+func (s *Session) Get(key string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rec.Values[key]
+}
+
+// Set sets the value by given key, a value of struct type
+// must be registered to gob like values of cacher
+func (s *Session) Set(key string, v interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rec.Values == nil {
+		s.rec.Values = make(map[string]interface{})
+	}
+	s.rec.Values[key] = v
+	s.change()
+}
+
+// Delete deletes the value by given key
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rec.Values[key]; ok {
+		delete(s.rec.Values, key)
+		s.dirty = true
+	}
+}
+
+// Clear deletes all values and flashes
+func (s *Session) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rec.Values = nil
+	s.rec.Flashes = nil
+	if s.stored {
+		s.dirty = true
+	}
+}
+
+// SetFlash sets a flash value by given key, it is kept until read by Flash,
+// like a message shown once after a redirect
+func (s *Session) SetFlash(key string, v interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rec.Flashes == nil {
+		s.rec.Flashes = make(map[string]interface{})
+	}
+	s.rec.Flashes[key] = v
+	s.change()
+}
+
+// change marks the session to be saved, and writes the cookie of a new session,
+// must be called with lock held
+func (s *Session) change() {
+	s.dirty = true
+	if s.isNew && !s.cookie {
+		s.cookie = true
+		s.m.setCookie(s.w, s.id, s.m.opt.MaxAge)
+	}
+}
+
+// Flash returns the flash value by given key and deletes it, nil if not exist
+func (s *Session) Flash(key string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.rec.Flashes[key]
+	if ok {
+		delete(s.rec.Flashes, key)
+		s.dirty = true
+	}
+	return v
+}
+
+// Regenerate moves the session to a new id and deletes the old one,
+// call it on login to prevent session fixation, before the response is written
+func (s *Session) Regenerate() error {
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stored {
+		if err = s.m.c.Delete(s.id); err != nil {
+			return err
+		}
+	}
+	s.id = id
+	s.isNew = true
+	s.stored = false
+	s.cookie = false
+	s.destroyed = false
+	s.change()
+	return nil
+}
+
+// Destroy deletes the session and its cookie, on logout,
+// call it before the response is written
+func (s *Session) Destroy() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rec = record{}
+	s.destroyed = true
+	s.m.setCookie(s.w, "", -1)
+	if !s.stored {
+		return nil
+	}
+	s.stored = false
+	return s.m.c.Delete(s.id)
+}
+
+// Save stores the session if it is changed or its expiration is renewed,
+// the middleware saves it after the handlers
+func (s *Session) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty || s.destroyed {
+		return nil
+	}
+	ttl := int64((s.m.opt.MaxAge + time.Second - 1) / time.Second)
+	s.rec.Expiration = time.Now().Add(time.Duration(ttl) * time.Second).UnixNano()
+	if err := s.m.c.Set(s.id, s.rec, ttl); err != nil {
+		return err
+	}
+	s.stored = true
+	s.dirty = false
+	return nil
+}
+
+// newID returns a random session id
+func newID() (string, error) {
+	b := make([]byte, idBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// validID check id is in the format of session ids
+func validID(id string) bool {
+	if len(id) != base64.RawURLEncoding.EncodedLen(idBytes) {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func init() {
+	gob.Register(record{})
+}
@@ -0,0 +1,212 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-baa/baa"
+	"github.com/go-baa/cache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSession(t *testing.T) {
+	Convey("session", t, func() {
+		c := cache.New(cache.Options{
+			Name:    "testSession",
+			Adapter: "memory",
+		}).Namespace("session")
+		m := New(c, Options{})
+
+		// start runs a request with the cookies, returns the session and the response
+		start := func(m *Manager, cookies ...*http.Cookie) (*Session, *httptest.ResponseRecorder) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/", nil)
+			for _, cookie := range cookies {
+				r.AddCookie(cookie)
+			}
+			s, err := m.Start(w, r)
+			So(err, ShouldBeNil)
+			return s, w
+		}
+
+		Convey("new and load", func() {
+			s, w := start(m)
+			So(s.IsNew(), ShouldBeTrue)
+			// no cookie and nothing stored until changed
+			So(cookie(w), ShouldBeNil)
+			So(s.Save(), ShouldBeNil)
+			So(c.Exist(s.ID()), ShouldBeFalse)
+			s.Clear()
+			So(s.Save(), ShouldBeNil)
+			So(c.Exist(s.ID()), ShouldBeFalse)
+
+			s.Set("user", "1")
+			ck := cookie(w)
+			So(ck, ShouldNotBeNil)
+			So(ck.Name, ShouldEqual, DefaultCookieName)
+			So(ck.Value, ShouldEqual, s.ID())
+			So(ck.HttpOnly, ShouldBeTrue)
+			So(ck.MaxAge, ShouldEqual, 0)
+			s.Set("cart", "1")
+			So(len(w.Header().Values("Set-Cookie")), ShouldEqual, 1)
+			So(s.Save(), ShouldBeNil)
+
+			s2, w2 := start(m, ck)
+			So(s2.IsNew(), ShouldBeFalse)
+			So(s2.ID(), ShouldEqual, s.ID())
+			So(s2.Get("user"), ShouldEqual, "1")
+			So(s2.Get("none"), ShouldBeNil)
+			So(cookie(w2), ShouldBeNil)
+
+			s2.Delete("user")
+			So(s2.Save(), ShouldBeNil)
+			s3, _ := start(m, ck)
+			So(s3.Get("user"), ShouldBeNil)
+		})
+
+		Convey("unknown ids are not used", func() {
+			s, _ := start(m, &http.Cookie{Name: DefaultCookieName, Value: strings.Repeat("a", 43)})
+			So(s.IsNew(), ShouldBeTrue)
+			So(s.ID(), ShouldNotEqual, strings.Repeat("a", 43))
+			So(validID(s.ID()), ShouldBeTrue)
+
+			s, _ = start(m, &http.Cookie{Name: DefaultCookieName, Value: "../admin"})
+			So(s.IsNew(), ShouldBeTrue)
+			So(validID("../admin"), ShouldBeFalse)
+		})
+
+		Convey("flash", func() {
+			s, w := start(m)
+			s.SetFlash("message", "saved")
+			ck := cookie(w)
+			So(ck, ShouldNotBeNil)
+			So(s.Save(), ShouldBeNil)
+
+			s, _ = start(m, ck)
+			So(s.Flash("message"), ShouldEqual, "saved")
+			So(s.Flash("message"), ShouldBeNil)
+			So(s.Save(), ShouldBeNil)
+			s, _ = start(m, ck)
+			So(s.Flash("message"), ShouldBeNil)
+		})
+
+		Convey("regenerate", func() {
+			s, w := start(m)
+			s.Set("cart", "1")
+			So(s.Save(), ShouldBeNil)
+			ck := cookie(w)
+			old := s.ID()
+
+			s, w = start(m, ck)
+			So(s.Regenerate(), ShouldBeNil)
+			So(s.ID(), ShouldNotEqual, old)
+			So(cookie(w).Value, ShouldEqual, s.ID())
+			So(s.Save(), ShouldBeNil)
+			So(c.Exist(old), ShouldBeFalse)
+
+			s, _ = start(m, cookie(w))
+			So(s.IsNew(), ShouldBeFalse)
+			So(s.Get("cart"), ShouldEqual, "1")
+
+			// a new session regenerated is stored with its cookie
+			s, w = start(m)
+			So(s.Regenerate(), ShouldBeNil)
+			So(cookie(w).Value, ShouldEqual, s.ID())
+			So(s.Save(), ShouldBeNil)
+			So(c.Exist(s.ID()), ShouldBeTrue)
+		})
+
+		Convey("destroy", func() {
+			s, w := start(m)
+			s.Set("user", "1")
+			So(s.Save(), ShouldBeNil)
+			So(c.Exist(s.ID()), ShouldBeTrue)
+
+			s, w = start(m, cookie(w))
+			So(s.Destroy(), ShouldBeNil)
+			So(cookie(w).MaxAge, ShouldEqual, -1)
+			So(s.Save(), ShouldBeNil)
+			So(c.Exist(s.ID()), ShouldBeFalse)
+
+			// a new session is not stored before save
+			s, _ = start(m)
+			So(s.Destroy(), ShouldBeNil)
+		})
+
+		Convey("sliding expiration", func() {
+			m := New(c, Options{MaxAge: time.Second * 2, Persistent: true})
+			s, w := start(m)
+			s.Set("user", "1")
+			ck := cookie(w)
+			So(ck.MaxAge, ShouldEqual, 2)
+			So(s.Save(), ShouldBeNil)
+
+			// renewed when half of its life is gone
+			time.Sleep(time.Millisecond * 1100)
+			s, w = start(m, ck)
+			So(s.IsNew(), ShouldBeFalse)
+			So(cookie(w), ShouldNotBeNil)
+			So(s.Save(), ShouldBeNil)
+			time.Sleep(time.Millisecond * 1100)
+			s, _ = start(m, ck)
+			So(s.IsNew(), ShouldBeFalse)
+
+			// expired when idle
+			So(s.Save(), ShouldBeNil)
+			time.Sleep(time.Millisecond * 2100)
+			s, _ = start(m, ck)
+			So(s.IsNew(), ShouldBeTrue)
+		})
+	})
+}
+
+func TestSessionMiddleware(t *testing.T) {
+	Convey("session middleware", t, func() {
+		c := cache.New(cache.Options{
+			Name:    "testSessionMiddleware",
+			Adapter: "memory",
+		})
+		app := baa.New()
+		app.Use(Middleware(New(c, Options{})))
+		app.Get("/login", func(c *baa.Context) {
+			s := FromContext(c)
+			s.Regenerate()
+			s.Set("user", "baa")
+		})
+		app.Get("/user", func(c *baa.Context) {
+			user, _ := FromContext(c).Get("user").(string)
+			c.Resp.Write([]byte(user))
+		})
+
+		// a request not using the session gets no cookie
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest("GET", "/user", nil))
+		So(cookie(w), ShouldBeNil)
+
+		w = httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest("GET", "/login", nil))
+		ck := cookie(w)
+		So(ck, ShouldNotBeNil)
+
+		w = httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/user", nil)
+		r.AddCookie(ck)
+		app.ServeHTTP(w, r)
+		So(w.Body.String(), ShouldEqual, "baa")
+	})
+}
+
+// cookie returns the last session cookie set in the response, nil if not set
+func cookie(w *httptest.ResponseRecorder) *http.Cookie {
+	var ck *http.Cookie
+	// read the header map, Result keeps the headers of its first call
+	for _, c := range (&http.Response{Header: w.Header()}).Cookies() {
+		if c.Name == DefaultCookieName {
+			ck = c
+		}
+	}
+	return ck
+}
@@ -0,0 +1,311 @@
+// Package tiered providers a two-tier cache adapter for cacher,
+// an in-process memory cache as L1 over a remote cache as L2.
+package tiered
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/go-baa/cache"
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultL1TTL is the default maximum life time of L1 values
+const DefaultL1TTL = 10 * time.Second
+
+// Tiered implement a two-tier cache adapter for cacher,
+// reads go to L1 first and populate L1 from L2 on miss,
+// writes and deletes go to both tiers
+type Tiered struct {
+	Name   string
+	Prefix string
+	l1     *cache.Memory
+	l2     cache.Cacher
+	ttl    int64 // maximum ttl second of L1 values
+}
+
+// New create a cache instance of tiered
+func New() cache.Cacher {
+	return new(Tiered)
+}
+
+// L1 returns the memory cache of L1
+func (c *Tiered) L1() cache.Cacher {
+	return c.l1
+}
+
+// L2 returns the remote cache of L2
+func (c *Tiered) L2() cache.Cacher {
+	return c.l2
+}
+
+// Exist return true if value cached by given key
+func (c *Tiered) Exist(key string) bool {
+	return c.l1.Exist(key) || c.l2.Exist(key)
+}
+
+// Get returns value by given key, a value read from L2 is cached in L1
+// unless it is tagged, or L2 cannot tell its tags
+func (c *Tiered) Get(key string, out interface{}) error {
+	if err := c.l1.Get(key, out); err == nil {
+		return nil
+	}
+	store, ok := c.l2.(interface {
+		GetWithTags(key string, out interface{}) ([]string, error)
+	})
+	if !ok {
+		return c.l2.Get(key, out)
+	}
+	version := c.l1.Version()
+	tags, err := store.GetWithTags(key, out)
+	if err != nil || len(tags) > 0 {
+		return err
+	}
+	rv := reflect.ValueOf(out)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		// other instances need not invalidate a value read from L2,
+		// the value is not cached if L1 is changed during the read,
+		// it may be deleted or invalidated after the read
+		c.l1.SetLocalIfVersion(key, rv.Elem().Interface(), c.l1TTL(0), version)
+	}
+	return nil
+}
+
+// Set cache value by given key to both tiers, cache ttl second
+func (c *Tiered) Set(key string, v interface{}, ttl int64) error {
+	if err := c.l2.Set(key, v, ttl); err != nil {
+		c.l1.Delete(key)
+		return err
+	}
+	return c.l1.Set(key, v, c.l1TTL(ttl))
+}
+
+// SetWithTags cache value by given key like Set, and associates it with given tags.
+// A tagged value is kept in L2 only, an L1 of any instance cannot see its
+// invalidation by tags, so its older value is deleted from L1.
+func (c *Tiered) SetWithTags(key string, v interface{}, ttl int64, tags ...string) error {
+	if len(tags) == 0 {
+		return c.Set(key, v, ttl)
+	}
+	err := c.l2.SetWithTags(key, v, ttl, tags...)
+	if err2 := c.l1.Delete(key); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// InvalidateTags delete all cached data associated with given tags,
+// they are in L2 only
+func (c *Tiered) InvalidateTags(tags ...string) error {
+	return c.l2.InvalidateTags(tags...)
+}
+
+// Incr increases cached int-type value by given key as a counter,
+// counters live in L2, the L1 copy is deleted
+func (c *Tiered) Incr(key string) (int64, error) {
+	defer c.l1.Delete(key)
+	return c.l2.Incr(key)
+}
+
+// Decr decreases cached int-type value by given key as a counter,
+// counters live in L2, the L1 copy is deleted
+func (c *Tiered) Decr(key string) (int64, error) {
+	defer c.l1.Delete(key)
+	return c.l2.Decr(key)
+}
+
+// IncrBy increases cached int-type value by given key with delta atomically
+func (c *Tiered) IncrBy(key string, delta int64) (int64, error) {
+	defer c.l1.Delete(key)
+	return c.l2.IncrBy(key, delta)
+}
+
+// IncrByFloat increases cached numeric value by given key with float delta atomically
+func (c *Tiered) IncrByFloat(key string, delta float64) (float64, error) {
+	defer c.l1.Delete(key)
+	return c.l2.IncrByFloat(key, delta)
+}
+
+// IncrWithTTL increases cached int-type value by given key with delta atomically,
+// if key not exist, the counter is created with ttl second
+func (c *Tiered) IncrWithTTL(key string, delta int64, ttl int64) (int64, error) {
+	defer c.l1.Delete(key)
+	return c.l2.IncrWithTTL(key, delta, ttl)
+}
+
+// SetNX cache value by given key in L2 only if the key does not exist, returns true if cached,
+// returns cache.ErrNotSupported if L2 cannot support it
+func (c *Tiered) SetNX(key string, v string, ttl time.Duration) (bool, error) {
+	store, ok := c.l2.(interface {
+		SetNX(key string, v string, ttl time.Duration) (bool, error)
+	})
+	if !ok {
+		return false, cache.ErrNotSupported
+	}
+	defer c.l1.Delete(key)
+	return store.SetNX(key, v, ttl)
+}
+
+// CompareAndDelete delete cached data by given key from L2 only if its value is v, returns true if deleted
+func (c *Tiered) CompareAndDelete(key string, v string) (bool, error) {
+	store, ok := c.l2.(interface {
+		CompareAndDelete(key string, v string) (bool, error)
+	})
+	if !ok {
+		return false, cache.ErrNotSupported
+	}
+	defer c.l1.Delete(key)
+	return store.CompareAndDelete(key, v)
+}
+
+// CompareAndExpire sets ttl of cached data by given key in L2 only if its value is v, returns true if set
+func (c *Tiered) CompareAndExpire(key string, v string, ttl time.Duration) (bool, error) {
+	store, ok := c.l2.(interface {
+		CompareAndExpire(key string, v string, ttl time.Duration) (bool, error)
+	})
+	if !ok {
+		return false, cache.ErrNotSupported
+	}
+	return store.CompareAndExpire(key, v, ttl)
+}
+
+// Delete delete cached data by given key from both tiers
+func (c *Tiered) Delete(key string) error {
+	c.l1.Delete(key)
+	return c.l2.Delete(key)
+}
+
+// Flush delete all cached data under the cache prefix from both tiers
+func (c *Tiered) Flush() error {
+	c.l1.Flush()
+	return c.l2.Flush()
+}
+
+// FlushAll delete all data of both tiers
+func (c *Tiered) FlushAll() error {
+	c.l1.FlushAll()
+	return c.l2.FlushAll()
+}
+
+// Scan calls fn for each cached key of L2 matching given glob pattern
+func (c *Tiered) Scan(pattern string, fn func(key string) error) error {
+	return c.l2.Scan(pattern, fn)
+}
+
+// Keys returns cached keys of L2 which start with given prefix
+func (c *Tiered) Keys(prefix string) ([]string, error) {
+	return c.l2.Keys(prefix)
+}
+
+// Jitter returns the jitter of ttl, nil if not set
+func (c *Tiered) Jitter() *cache.Jitter {
+	return c.l1.Jitter()
+}
+
+// Namespace returns a cacher under the namespace of given name in both tiers
+func (c *Tiered) Namespace(name string) cache.Cacher {
+	return &Tiered{
+		Name:   c.Name,
+		Prefix: cache.NamespacePrefix(c.Prefix, name),
+		l1:     c.l1.Namespace(name).(*cache.Memory),
+		l2:     c.l2.Namespace(name),
+		ttl:    c.ttl,
+	}
+}
+
+// l1TTL returns the ttl of L1 value, capped by the L1 ttl
+func (c *Tiered) l1TTL(ttl int64) int64 {
+	if ttl <= 0 || ttl > c.ttl {
+		return c.ttl
+	}
+	return ttl
+}
+
+// Start new a cacher and start service
+func (c *Tiered) Start(o cache.Options) error {
+	c.Name = o.Name
+	c.Prefix = o.Prefix
+
+	l1TTL, err := cache.ConfigDuration(o.Config, "l1TTL", DefaultL1TTL)
+	if err != nil {
+		return err
+	}
+	c.ttl = int64(l1TTL / time.Second)
+	if c.ttl <= 0 {
+		return fmt.Errorf("tiered: l1TTL must be at least one second")
+	}
+	l1Config := make(map[string]interface{})
+	if v, ok := cache.ConfigValue(o.Config, "l1BytesLimit"); ok {
+		l1Config["bytesLimit"] = v
+	}
+	if v, ok := cache.ConfigValue(o.Config, "bus"); ok {
+		l1Config["bus"] = v
+	}
+	l1, err := cache.NewCacher("memory", cache.Options{
+		Name:       o.Name,
+		Adapter:    "memory",
+		Prefix:     o.Prefix,
+		Config:     l1Config,
+		Jitter:     o.Jitter,
+		JitterSeed: o.JitterSeed,
+	})
+	if err != nil {
+		return err
+	}
+	c.l1 = l1.(*cache.Memory)
+
+	c.l2, err = l2(o)
+	return err
+}
+
+// l2 returns the L2 cacher by config l2, which is a Cacher, cache options,
+// a map of cache options or a cache url
+func l2(o cache.Options) (cache.Cacher, error) {
+	var l2 cache.Options
+	v, _ := cache.ConfigValue(o.Config, "l2")
+	switch t := v.(type) {
+	case nil:
+		return nil, fmt.Errorf("tiered: config l2 is required")
+	case cache.Cacher:
+		return t, nil
+	case cache.Options:
+		l2 = t
+	case *cache.Options:
+		l2 = *t
+	case string:
+		var err error
+		if l2, err = cache.ParseURL(t); err != nil {
+			return nil, err
+		}
+	case map[string]interface{}, map[interface{}]interface{}:
+		// options from json or yaml file
+		data, err := yaml.Marshal(t)
+		if err != nil {
+			return nil, err
+		}
+		if l2, err = cache.OptionsFromYAML(data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("tiered: config l2 expects cacher, options or url, got %T", t)
+	}
+	if l2.Name == "" || l2.Name == "_DEFAULT_" {
+		l2.Name = o.Name
+	}
+	if l2.Prefix == "" {
+		l2.Prefix = o.Prefix
+	}
+	if l2.Jitter == 0 {
+		l2.Jitter = o.Jitter
+		l2.JitterSeed = o.JitterSeed
+	}
+	if l2.Adapter == "" {
+		return nil, fmt.Errorf("tiered: adapter of l2 is required")
+	}
+	return cache.NewCacher(l2.Adapter, l2)
+}
+
+func init() {
+	cache.Register("tiered", New)
+}
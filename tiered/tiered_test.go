@@ -0,0 +1,285 @@
+package tiered
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-baa/cache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCacheTiered(t *testing.T) {
+	Convey("cache tiered", t, func() {
+		l2 := cache.New(cache.Options{
+			Name:    "testL2",
+			Adapter: "memory",
+		})
+		c := cache.New(cache.Options{
+			Name:    "testTiered",
+			Adapter: "tiered",
+			Config: map[string]interface{}{
+				"l2":    l2,
+				"l1TTL": 1,
+			},
+		})
+		l1 := c.(*Tiered).L1()
+
+		Convey("write through", func() {
+			err := c.Set("test", "1", 10)
+			So(err, ShouldBeNil)
+			So(l1.Exist("test"), ShouldBeTrue)
+			So(l2.Exist("test"), ShouldBeTrue)
+			var v string
+			err = c.Get("test", &v)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "1")
+		})
+
+		Convey("read through", func() {
+			l2.Set("remote", "2", 10)
+			So(l1.Exist("remote"), ShouldBeFalse)
+			var v string
+			err := c.Get("remote", &v)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "2")
+			So(l1.Exist("remote"), ShouldBeTrue)
+
+			var miss string
+			err = c.Get("notExist", &miss)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("l1 ttl cap", func() {
+			c.Set("ttl", "3", 10)
+			time.Sleep(time.Millisecond * 1100)
+			So(l1.Exist("ttl"), ShouldBeFalse)
+			So(c.Exist("ttl"), ShouldBeTrue)
+		})
+
+		Convey("delete both tiers", func() {
+			c.Set("delete", "4", 10)
+			err := c.Delete("delete")
+			So(err, ShouldBeNil)
+			So(l1.Exist("delete"), ShouldBeFalse)
+			So(l2.Exist("delete"), ShouldBeFalse)
+
+			c.SetWithTags("tagged", "5", 10, "tag")
+			err = c.InvalidateTags("tag")
+			So(err, ShouldBeNil)
+			So(c.Exist("tagged"), ShouldBeFalse)
+
+			c.Set("flush", "6", 10)
+			err = c.Flush()
+			So(err, ShouldBeNil)
+			So(c.Exist("flush"), ShouldBeFalse)
+		})
+
+		Convey("counters", func() {
+			c.Set("counter", 1, 10)
+			v, err := c.IncrBy("counter", 2)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, 3)
+			var n int64
+			err = c.Get("counter", &n)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 3)
+		})
+
+		Convey("namespace", func() {
+			orders := c.Namespace("orders")
+			orders.Set("1", "order", 10)
+			So(l2.Namespace("orders").Exist("1"), ShouldBeTrue)
+			So(c.Exist("1"), ShouldBeFalse)
+		})
+
+		Convey("lock", func() {
+			t := c.(*Tiered)
+			l1.Set("lock", "stale", 10)
+			ok, err := t.SetNX("lock", "a", time.Second)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(l1.Exist("lock"), ShouldBeFalse)
+			ok, _ = t.SetNX("lock", "b", time.Second)
+			So(ok, ShouldBeFalse)
+
+			ok, err = t.CompareAndExpire("lock", "a", time.Second)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			ok, _ = t.CompareAndDelete("lock", "b")
+			So(ok, ShouldBeFalse)
+			ok, _ = t.CompareAndDelete("lock", "a")
+			So(ok, ShouldBeTrue)
+			So(l2.Exist("lock"), ShouldBeFalse)
+		})
+	})
+}
+
+func TestCacheTieredBus(t *testing.T) {
+	Convey("cache tiered bus", t, func() {
+		l2 := cache.New(cache.Options{
+			Name:    "testL2",
+			Adapter: "memory",
+		})
+		bus := cache.NewLocalBus()
+		newTiered := func() cache.Cacher {
+			return cache.New(cache.Options{
+				Name:    "testTieredBus",
+				Adapter: "tiered",
+				Config: map[string]interface{}{
+					"l2":  l2,
+					"bus": bus,
+				},
+			})
+		}
+		c1, c2 := newTiered(), newTiered()
+
+		c1.Set("key", "1", 10)
+		var v string
+		So(c2.Get("key", &v), ShouldBeNil)
+		So(c2.(*Tiered).L1().Exist("key"), ShouldBeTrue)
+
+		c1.Set("key", "2", 10)
+		So(c2.(*Tiered).L1().Exist("key"), ShouldBeFalse)
+		So(c2.Get("key", &v), ShouldBeNil)
+		So(v, ShouldEqual, "2")
+
+		c1.Delete("key")
+		So(c2.Exist("key"), ShouldBeFalse)
+	})
+}
+
+func TestCacheTieredTags(t *testing.T) {
+	Convey("cache tiered tags", t, func() {
+		l2 := cache.New(cache.Options{
+			Name:    "testL2",
+			Adapter: "memory",
+		})
+		newTiered := func() cache.Cacher {
+			return cache.New(cache.Options{
+				Name:    "testTieredTags",
+				Adapter: "tiered",
+				Config:  map[string]interface{}{"l2": l2},
+			})
+		}
+		c1, c2 := newTiered(), newTiered()
+
+		So(c1.SetWithTags("key", "1", 10, "tag"), ShouldBeNil)
+		So(c1.(*Tiered).L1().Exist("key"), ShouldBeFalse)
+		var v string
+		So(c2.Get("key", &v), ShouldBeNil)
+		So(v, ShouldEqual, "1")
+		So(c2.(*Tiered).L1().Exist("key"), ShouldBeFalse)
+
+		So(c2.InvalidateTags("tag"), ShouldBeNil)
+		So(c1.Get("key", &v), ShouldNotBeNil)
+		So(c2.Get("key", &v), ShouldNotBeNil)
+
+		// an untagged value replacing a tagged one is cached in L1 again
+		So(c1.Set("key", "2", 10), ShouldBeNil)
+		So(c2.Get("key", &v), ShouldBeNil)
+		So(c2.(*Tiered).L1().Exist("key"), ShouldBeTrue)
+	})
+}
+
+func TestCacheTieredReadDuringInvalidation(t *testing.T) {
+	Convey("cache tiered read during invalidation", t, func() {
+		l2 := cache.New(cache.Options{
+			Name:    "testL2",
+			Adapter: "memory",
+		})
+		bus := cache.NewLocalBus()
+		c1 := cache.New(cache.Options{
+			Name:    "testTieredRace",
+			Adapter: "tiered",
+			Config:  map[string]interface{}{"l2": l2, "bus": bus},
+		})
+		// another instance deletes the key after c2 reads it from L2
+		slow := &afterGet{Cacher: l2}
+		c2 := cache.New(cache.Options{
+			Name:    "testTieredRace",
+			Adapter: "tiered",
+			Config:  map[string]interface{}{"l2": slow, "bus": bus},
+		})
+
+		c1.Set("key", "1", 10)
+		slow.fn = func() { c1.Delete("key") }
+		var v string
+		So(c2.Get("key", &v), ShouldBeNil)
+		So(v, ShouldEqual, "1")
+		So(c2.(*Tiered).L1().Exist("key"), ShouldBeFalse)
+
+		slow.fn = func() {}
+		c1.Set("key", "2", 10)
+		So(c2.Get("key", &v), ShouldBeNil)
+		So(c2.(*Tiered).L1().Exist("key"), ShouldBeTrue)
+	})
+}
+
+// afterGet calls fn after each Get of the cacher
+type afterGet struct {
+	cache.Cacher
+	fn func()
+}
+
+func (c *afterGet) Get(key string, out interface{}) error {
+	err := c.Cacher.Get(key, out)
+	c.fn()
+	return err
+}
+
+func (c *afterGet) GetWithTags(key string, out interface{}) ([]string, error) {
+	tags, err := c.Cacher.(*cache.Memory).GetWithTags(key, out)
+	c.fn()
+	return tags, err
+}
+
+func TestCacheTieredConfig(t *testing.T) {
+	Convey("cache tiered config", t, func() {
+		_, err := cache.NewCacher("tiered", cache.Options{})
+		So(err, ShouldNotBeNil)
+
+		_, err = cache.NewCacher("tiered", cache.Options{
+			Config: map[string]interface{}{"l2": 1},
+		})
+		So(err, ShouldNotBeNil)
+
+		c, err := cache.NewCacher("tiered", cache.Options{
+			Name:   "testConfig",
+			Prefix: "app:",
+			Config: map[string]interface{}{
+				"l2": map[string]interface{}{
+					"adapter": "memory",
+					"config": map[string]interface{}{
+						"bytesLimit": 1 << 21,
+					},
+				},
+				"l1BytesLimit": 1 << 20,
+			},
+		})
+		So(err, ShouldBeNil)
+		So(c.(*Tiered).L2().(*cache.Memory).Prefix, ShouldEqual, "app:")
+
+		c, err = cache.NewCacher("tiered", cache.Options{
+			Config: map[string]interface{}{
+				"l2": "memory://?prefix=url:",
+			},
+		})
+		So(err, ShouldBeNil)
+		So(c.(*Tiered).L2().(*cache.Memory).Prefix, ShouldEqual, "url:")
+		// keys from environment match the options
+		c, err = cache.NewCacher("tiered", cache.Options{
+			Config: map[string]interface{}{
+				"L2":             "memory://",
+				"l1_bytes_limit": "4194304",
+			},
+		})
+		So(err, ShouldBeNil)
+		_, err = cache.NewCacher("tiered", cache.Options{
+			Config: map[string]interface{}{
+				"l2":             "memory://",
+				"l1_bytes_limit": "large",
+			},
+		})
+		So(err, ShouldNotBeNil)
+	})
+}
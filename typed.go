@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+)
+
+// Codec encodes values of type T to bytes and back, for Typed
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// JSONCodec encodes values by encoding/json
+type JSONCodec[T any] struct{}
+
+// Encode encodes v to json
+func (JSONCodec[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Decode decodes a value from json
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// GobCodec encodes values by encoding/gob, the type need not be registered
+type GobCodec[T any] struct{}
+
+// Encode encodes v to gob
+func (GobCodec[T]) Encode(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(&v)
+	return buf.Bytes(), err
+}
+
+// Decode decodes a value from gob
+func (GobCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+// Typed reads and writes values of type T through a cacher, type checked
+// at compile time. Without a codec values are stored in the wire format
+// of cacher, shared with Get and Set of the cacher, a struct type must be
+// registered to gob. With a codec values are stored as bytes by it.
+type Typed[T any] struct {
+	Cacher Cacher
+	Codec  Codec[T] // codec of values, nil for the wire format of cacher
+	TTL    int64    // ttl second of values loaded by GetOrLoad
+
+	calls group[T]
+}
+
+// NewTyped create a typed cacher over c, values are encoded by codec,
+// nil for the wire format of cacher, ttl is the ttl second of GetOrLoad
+func NewTyped[T any](c Cacher, ttl int64, codec Codec[T]) *Typed[T] {
+	return &Typed[T]{
+		Cacher: c,
+		Codec:  codec,
+		TTL:    ttl,
+	}
+}
+
+// Get returns value by given key, and reports whether it exists
+func (t *Typed[T]) Get(key string) (T, bool, error) {
+	var v T
+	var err error
+	if t.Codec == nil {
+		err = t.Cacher.Get(key, &v)
+	} else {
+		var data []byte
+		if err = t.Cacher.Get(key, &data); err == nil {
+			v, err = t.Codec.Decode(data)
+		}
+	}
+	if err != nil {
+		var zero T
+		if errors.Is(err, ErrCacheMiss) {
+			return zero, false, nil
+		}
+		return zero, false, err
+	}
+	return v, true, nil
+}
+
+// Set cache value by given key, cache ttl second
+func (t *Typed[T]) Set(key string, v T, ttl int64) error {
+	if t.Codec == nil {
+		return t.Cacher.Set(key, v, ttl)
+	}
+	data, err := t.Codec.Encode(v)
+	if err != nil {
+		return err
+	}
+	return t.Cacher.Set(key, data, ttl)
+}
+
+// GetOrLoad returns value by given key, a missing value is loaded by loader
+// and cached for TTL seconds. Concurrent loads of a key are merged into one call,
+// a panic of loader is returned as the error of all callers.
+func (t *Typed[T]) GetOrLoad(key string, loader func() (T, error)) (T, error) {
+	v, ok, err := t.Get(key)
+	if err != nil || ok {
+		return v, err
+	}
+
+	call := t.calls.do(key, false, func() (T, error) {
+		v, err := loader()
+		if err == nil {
+			err = t.Set(key, v, t.TTL)
+		}
+		return v, err
+	}, nil)
+	<-call.done
+	return call.val, call.err
+}
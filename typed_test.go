@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCacheTyped(t *testing.T) {
+	Convey("cache typed", t, func() {
+		c := New(Options{
+			Name:    "testTyped",
+			Adapter: "memory",
+		})
+		type user struct {
+			ID   int64
+			Name string
+		}
+
+		Convey("get and set", func() {
+			ints := NewTyped[int64](c, 10, nil)
+			So(ints.Set("int", 42, 10), ShouldBeNil)
+			v, ok, err := ints.Get("int")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(v, ShouldEqual, 42)
+
+			v, ok, err = ints.Get("notExist")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+			So(v, ShouldEqual, 0)
+
+			// shares the wire format with the cacher
+			c.Set("plain", "baa", 10)
+			s, ok, err := NewTyped[string](c, 10, nil).Get("plain")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(s, ShouldEqual, "baa")
+			_, _, err = ints.Get("plain")
+			So(err, ShouldNotBeNil)
+
+			times := NewTyped[time.Duration](c, 10, nil)
+			times.Set("duration", time.Minute, 10)
+			d, _, _ := times.Get("duration")
+			So(d, ShouldEqual, time.Minute)
+		})
+
+		Convey("codecs", func() {
+			for _, codec := range []Codec[user]{JSONCodec[user]{}, GobCodec[user]{}} {
+				users := NewTyped[user](c, 10, codec)
+				So(users.Set("user", user{1, "baa"}, 10), ShouldBeNil)
+				u, ok, err := users.Get("user")
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeTrue)
+				So(u, ShouldResemble, user{1, "baa"})
+			}
+
+			ptrs := NewTyped[*user](c, 10, JSONCodec[*user]{})
+			ptrs.Set("ptr", &user{2, "cache"}, 10)
+			p, _, err := ptrs.Get("ptr")
+			So(err, ShouldBeNil)
+			So(p.Name, ShouldEqual, "cache")
+
+			c.Set("bad", "{", 10)
+			_, ok, err := ptrs.Get("bad")
+			So(err, ShouldNotBeNil)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("get or load", func() {
+			users := NewTyped[user](c, 10, GobCodec[user]{})
+			var loads int64
+			load := func() (user, error) {
+				atomic.AddInt64(&loads, 1)
+				time.Sleep(time.Millisecond * 50)
+				return user{3, "loaded"}, nil
+			}
+
+			var wg sync.WaitGroup
+			values := make([]user, 10)
+			for i := range values {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					values[i], _ = users.GetOrLoad("load", load)
+				}(i)
+			}
+			wg.Wait()
+			for _, u := range values {
+				So(u.Name, ShouldEqual, "loaded")
+			}
+			So(atomic.LoadInt64(&loads), ShouldEqual, 1)
+
+			u, err := users.GetOrLoad("load", load)
+			So(err, ShouldBeNil)
+			So(u.ID, ShouldEqual, 3)
+			So(atomic.LoadInt64(&loads), ShouldEqual, 1)
+
+			_, err = users.GetOrLoad("fail", func() (user, error) {
+				return user{}, errors.New("load failed")
+			})
+			So(err, ShouldNotBeNil)
+			So(c.Exist("fail"), ShouldBeFalse)
+		})
+
+		Convey("failed loads", func() {
+			users := NewTyped[user](c, 10, GobCodec[user]{})
+			for _, load := range []func() (user, error){
+				func() (user, error) {
+					time.Sleep(time.Millisecond * 50)
+					panic("load panic")
+				},
+				func() (user, error) {
+					time.Sleep(time.Millisecond * 50)
+					return user{}, errors.New("load failed")
+				},
+			} {
+				var wg sync.WaitGroup
+				errs := make([]error, 10)
+				for i := range errs {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						_, errs[i] = users.GetOrLoad("failed", load)
+					}(i)
+				}
+				wg.Wait()
+				for _, err := range errs {
+					So(err, ShouldNotBeNil)
+				}
+				So(users.calls.calls, ShouldBeEmpty)
+				So(c.Exist("failed"), ShouldBeFalse)
+			}
+
+			// the next load runs again
+			u, err := users.GetOrLoad("failed", func() (user, error) {
+				return user{4, "recovered"}, nil
+			})
+			So(err, ShouldBeNil)
+			So(u.Name, ShouldEqual, "recovered")
+		})
+
+		Convey("cache miss", func() {
+			var v string
+			err := c.Get("notExist", &v)
+			So(errors.Is(err, ErrCacheMiss), ShouldBeTrue)
+
+			origin := errors.New("client miss")
+			err = MissError(origin)
+			So(errors.Is(err, ErrCacheMiss), ShouldBeTrue)
+			So(errors.Is(err, origin), ShouldBeTrue)
+			So(err.Error(), ShouldEqual, "client miss")
+		})
+	})
+}